@@ -0,0 +1,90 @@
+package grep
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/leep-frog/command/commander"
+)
+
+var (
+	keepColorsFlag = commander.BoolFlag("keep-colors", commander.FlagNoShortName, "Keep the input's colors outside of matched segments. By default, ANSI escape codes are removed from the input before matching and printing")
+
+	// ansiRegex matches ANSI CSI escape sequences (which include SGR color
+	// sequences like `\x1b[31m`).
+	ansiRegex = regexp.MustCompile("\x1b\\[[0-?]*[ -/]*[@-~]")
+)
+
+// stripANSI removes all ANSI escape sequences from the string.
+func stripANSI(s string) string {
+	return ansiRegex.ReplaceAllString(s, "")
+}
+
+// isSGRReset returns whether or not the escape sequence resets all colors.
+func isSGRReset(code string) bool {
+	return code == "\x1b[m" || code == "\x1b[0m"
+}
+
+// restoreANSI re-inserts the escape sequences of the original string into
+// the non-matching segments of the formatted string (which was generated from
+// the stripped string). Escape sequences inside matched segments are dropped,
+// and the colors that were active before a match are restored after it.
+func restoreANSI(original string, formattedString []string) []string {
+	locs := ansiRegex.FindAllStringIndex(original, -1)
+	if len(locs) == 0 {
+		return formattedString
+	}
+
+	r := make([]string, 0, len(formattedString))
+	// active contains the color sequences since the last reset.
+	var active []string
+	var li, oi int
+	for i, seg := range formattedString {
+		inMatch := i%2 == 1
+		var sb strings.Builder
+		if !inMatch && i > 0 {
+			sb.WriteString(strings.Join(active, ""))
+		}
+
+		for n := len(seg); ; {
+			// Escape sequences at the end of a match belong to the next
+			// (non-matching) segment.
+			if n == 0 && inMatch {
+				break
+			}
+
+			// Handle escape sequences at the current position.
+			for li < len(locs) && locs[li][0] == oi {
+				code := original[locs[li][0]:locs[li][1]]
+				if isSGRReset(code) {
+					active = nil
+				} else if strings.HasSuffix(code, "m") {
+					active = append(active, code)
+				}
+				if !inMatch {
+					sb.WriteString(code)
+				}
+				oi = locs[li][1]
+				li++
+			}
+			if n == 0 {
+				break
+			}
+
+			// Copy visible characters up to the next escape sequence.
+			end := len(original)
+			if li < len(locs) {
+				end = locs[li][0]
+			}
+			k := end - oi
+			if n < k {
+				k = n
+			}
+			sb.WriteString(original[oi : oi+k])
+			oi += k
+			n -= k
+		}
+		r = append(r, sb.String())
+	}
+	return r
+}
@@ -0,0 +1,60 @@
+package grep
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRestoreANSI(t *testing.T) {
+	for _, test := range []struct {
+		name            string
+		original        string
+		formattedString []string
+		want            []string
+	}{
+		{
+			name:            "handles string without escape codes",
+			original:        "alpha bravo",
+			formattedString: []string{"alpha ", "bravo", ""},
+			want:            []string{"alpha ", "bravo", ""},
+		},
+		{
+			name:            "keeps escape codes outside of matches",
+			original:        "\x1b[31mred\x1b[0m alpha \x1b[34mblue\x1b[0m",
+			formattedString: []string{"red ", "alpha", " blue"},
+			want:            []string{"\x1b[31mred\x1b[0m ", "alpha", " \x1b[34mblue\x1b[0m"},
+		},
+		{
+			name:            "restores colors after match",
+			original:        "\x1b[31mred alpha red\x1b[0m",
+			formattedString: []string{"red ", "alpha", " red"},
+			want:            []string{"\x1b[31mred ", "alpha", "\x1b[31m red\x1b[0m"},
+		},
+		{
+			name:            "drops escape codes inside matches",
+			original:        "one \x1b[1mtwo\x1b[0m three",
+			formattedString: []string{"", "one two", " three"},
+			want:            []string{"", "one two", "\x1b[1m\x1b[0m three"},
+		},
+		{
+			name:            "restores multiple active colors",
+			original:        "\x1b[1m\x1b[32mbold green\x1b[0m",
+			formattedString: []string{"", "bold", " green"},
+			want:            []string{"\x1b[1m\x1b[32m", "bold", "\x1b[1m\x1b[32m green\x1b[0m"},
+		},
+		{
+			name:            "keeps non-color escape codes",
+			original:        "alpha\x1b[K bravo",
+			formattedString: []string{"", "alpha", " bravo"},
+			want:            []string{"", "alpha", "\x1b[K bravo"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := restoreANSI(test.original, test.formattedString)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("restoreANSI(%q, %v) returned incorrect value (-want, +got):\n%s", test.original, test.formattedString, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package grep
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+var (
+	execFlag     = commander.Flag[string]("exec", 'e', "Run this command for each result. `{}` is replaced with the path and `{N}` with the Nth capture group of the first pattern that matches. If the command ends with `{} +`, then it's run once with all of the paths instead")
+	parallelFlag = commander.Flag[int]("parallel", 'P', "The number of --exec commands to run at once", commander.Positive[int]())
+	failFastFlag = commander.BoolFlag("fail-fast", commander.FlagNoShortName, "Stop running --exec commands after the first one fails")
+
+	// placeholderRegex matches the placeholders in an exec command.
+	placeholderRegex = regexp.MustCompile(`\{(\d*)\}`)
+
+	// runCommand runs the command and returns its stdout and stderr.
+	runCommand = func(args []string) ([]byte, []byte, error) {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		return stdout.Bytes(), stderr.Bytes(), err
+	}
+)
+
+// execJob is a single run of the exec command.
+type execJob struct {
+	// path is the path that the command was run for (or empty for batched
+	// commands).
+	path string
+	args []string
+
+	stdout  []byte
+	stderr  []byte
+	err     error
+	skipped bool
+	done    chan struct{}
+}
+
+// splitCommand splits the command into arguments. Arguments are separated by
+// whitespace, unless the whitespace is in single or double quotes.
+func splitCommand(s string) ([]string, error) {
+	var args []string
+	var sb strings.Builder
+	var quote rune
+	var inArg bool
+	for _, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				sb.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, sb.String())
+				sb.Reset()
+				inArg = false
+			}
+		default:
+			sb.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, sb.String())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	return args, nil
+}
+
+// capturePatterns returns the compiled patterns (in order) whose capture
+// groups can be used in placeholders.
+func capturePatterns(data *command.Data) []*regexp.Regexp {
+	var rs []*regexp.Regexp
+	for _, patternGroup := range command.GetData[[][]string](data, patternArgName) {
+		for _, pattern := range patternGroup {
+			// ListIsRegex ensures that only valid regexes reach this point.
+			rs = append(rs, regexp.MustCompile(patternRegex(pattern, data)))
+		}
+	}
+	return rs
+}
+
+// captureGroups returns the capture groups (including the entire match) of
+// the first pattern that matches the name.
+func captureGroups(patterns []*regexp.Regexp, name string) []string {
+	for _, r := range patterns {
+		if m := r.FindStringSubmatch(name); m != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+// expandCommand replaces the placeholders in the arguments with the path and
+// capture groups.
+func expandCommand(args []string, path string, groups []string) ([]string, error) {
+	var err error
+	r := make([]string, 0, len(args))
+	for _, arg := range args {
+		r = append(r, placeholderRegex.ReplaceAllStringFunc(arg, func(p string) string {
+			n := p[1 : len(p)-1]
+			if n == "" {
+				return path
+			}
+			i, _ := strconv.Atoi(n)
+			if i >= len(groups) {
+				err = fmt.Errorf("capture group %s doesn't exist for %q", p, path)
+				return p
+			}
+			return groups[i]
+		}))
+	}
+	return r, err
+}
+
+// execJobs returns the jobs for running the exec command on the matches.
+func execJobs(data *command.Data, matches []*fileMatch) ([]*execJob, error) {
+	args, err := splitCommand(execFlag.Get(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid exec command: %v", err)
+	}
+
+	// Batched commands are run once with all of the paths.
+	if n := len(args); n >= 2 && args[n-2] == "{}" && args[n-1] == "+" {
+		args = args[:n-2]
+		if len(args) == 0 || placeholderRegex.MatchString(strings.Join(args, " ")) {
+			return nil, fmt.Errorf("invalid exec command: `{} +` must be the only placeholder")
+		}
+		if len(matches) == 0 {
+			return nil, nil
+		}
+		for _, m := range matches {
+			args = append(args, m.path)
+		}
+		return []*execJob{{args: args}}, nil
+	}
+
+	patterns := capturePatterns(data)
+	var jobs []*execJob
+	for _, m := range matches {
+		expanded, err := expandCommand(args, m.path, captureGroups(patterns, m.name))
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &execJob{path: m.path, args: expanded})
+	}
+	return jobs, nil
+}
+
+// runExec runs the exec command on each of the matches. Commands are run in
+// parallel (if requested), but their output is written in order. Each line of
+// output is prefixed by the path that the command was run for.
+func runExec(output command.Output, data *command.Data, matches []*fileMatch) error {
+	jobs, err := execJobs(data, matches)
+	if err != nil {
+		return output.Stderrln(err)
+	}
+
+	parallel := 1
+	if data.Has(parallelFlag.Name()) {
+		parallel = parallelFlag.Get(data)
+	}
+	failFast := failFastFlag.Get(data)
+
+	for _, j := range jobs {
+		j.done = make(chan struct{})
+	}
+	go func() {
+		sem := make(chan struct{}, parallel)
+		var failed atomic.Bool
+		for _, j := range jobs {
+			sem <- struct{}{}
+			if failFast && failed.Load() {
+				j.skipped = true
+				close(j.done)
+				<-sem
+				continue
+			}
+			go func(j *execJob) {
+				j.stdout, j.stderr, j.err = runCommand(j.args)
+				// This is set before the slot is released, so (without
+				// parallelism) no commands are started after a failure.
+				if j.err != nil {
+					failed.Store(true)
+				}
+				close(j.done)
+				<-sem
+			}(j)
+		}
+	}()
+
+	var failures int
+	for _, j := range jobs {
+		<-j.done
+		if j.skipped {
+			continue
+		}
+		writeCommandOutput(output, data, j.path, j.stdout, false)
+		writeCommandOutput(output, data, j.path, j.stderr, true)
+		if j.err != nil {
+			failures++
+			if j.path == "" {
+				output.Stderrf("command failed: %v\n", j.err)
+			} else {
+				output.Stderrf("%s: command failed: %v\n", j.path, j.err)
+			}
+		}
+	}
+
+	if failures > 0 {
+		return output.Stderrf("%d of %d commands failed\n", failures, len(jobs))
+	}
+	return nil
+}
+
+// writeCommandOutput writes each line of the command's output (to stdout or
+// stderr), prefixed by the path (if set).
+func writeCommandOutput(output command.Output, data *command.Data, path string, b []byte, stderr bool) {
+	if len(b) == 0 {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+		switch {
+		case stderr && path != "":
+			output.Stderrf("%s: %s\n", path, line)
+		case stderr:
+			output.Stderrln(line)
+		case path != "":
+			applyFormatWithColor(output, data, fileColor, []string{"", path})
+			output.Stdoutf(": %s\n", line)
+		default:
+			output.Stdoutln(line)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package grep
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+const (
+	nameSort  = "name"
+	sizeSort  = "size"
+	mtimeSort = "mtime"
+
+	mtimeFormat = "2006-01-02 15:04"
+)
+
+var (
+	fileSorts         = []string{nameSort, sizeSort, mtimeSort}
+	longFlag          = commander.BoolFlag("long", 'l', "Show the permissions, size, and modification time of each file, and a type marker after its path (like `ls -lF`)")
+	humanReadableFlag = commander.BoolFlag("human-readable", 'h', "With --long, show sizes in human-readable units (e.g. 1.5K, 20M)")
+	sortFlag          = commander.Flag[string]("sort", 's', "Sort results by name (base name), size (largest first), or mtime (newest first) instead of walk order", commander.InList(fileSorts...), commander.SimpleCompleter[string](fileSorts...))
+	reverseFlag       = commander.BoolFlag("reverse", 'r', "Reverse the order of the results")
+)
+
+// fileMatch is a file (or directory) whose name matched the filter.
+type fileMatch struct {
+	path string
+	// name is the string that the patterns were matched against.
+	name string
+	// dir is the part of the path that isn't included in formattedString.
+	dir             string
+	formattedString []string
+	de              fs.DirEntry
+	// info is only set if the matches are collected (rather than written as
+	// they're found).
+	info fs.FileInfo
+}
+
+// sortMatches sorts the matches by the sort flag (or leaves them in walk
+// order if it isn't provided), and then reverses them if requested.
+func sortMatches(data *command.Data, matches []*fileMatch) {
+	var less func(a, b *fileMatch) bool
+	switch sortFlag.Get(data) {
+	case nameSort:
+		less = func(a, b *fileMatch) bool { return a.de.Name() < b.de.Name() }
+	case sizeSort:
+		less = func(a, b *fileMatch) bool { return a.info.Size() > b.info.Size() }
+	case mtimeSort:
+		less = func(a, b *fileMatch) bool { return a.info.ModTime().After(b.info.ModTime()) }
+	}
+	if less != nil {
+		sort.SliceStable(matches, func(i, j int) bool { return less(matches[i], matches[j]) })
+	}
+
+	if reverseFlag.Get(data) {
+		for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+			matches[i], matches[j] = matches[j], matches[i]
+		}
+	}
+}
+
+// longColumns writes the columns that come before the path in long format.
+// Columns are aligned across all matches.
+type longColumns struct {
+	human     bool
+	modeWidth int
+	sizeWidth int
+}
+
+func newLongColumns(data *command.Data, matches []*fileMatch) *longColumns {
+	lc := &longColumns{
+		human: humanReadableFlag.Get(data),
+	}
+	for _, m := range matches {
+		lc.modeWidth = max(lc.modeWidth, len(m.info.Mode().String()))
+		lc.sizeWidth = max(lc.sizeWidth, len(lc.size(m.info)))
+	}
+	return lc
+}
+
+func (lc *longColumns) size(info fs.FileInfo) string {
+	if lc.human {
+		return humanSize(info.Size())
+	}
+	return strconv.FormatInt(info.Size(), 10)
+}
+
+func (lc *longColumns) write(output command.Output, data *command.Data, m *fileMatch) {
+	output.Stdoutf("%-*s %*s ", lc.modeWidth, m.info.Mode().String(), lc.sizeWidth, lc.size(m.info))
+	applyFormatWithColor(output, data, timestampColor, []string{"", m.info.ModTime().Format(mtimeFormat)})
+	output.Stdout(" ")
+}
+
+// humanSize returns the size in the largest (1024-based) unit in which it's
+// at least one once rounded. Sizes under 10 units include one decimal place
+// (like `ls -h`).
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatInt(n, 10)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	v := float64(n) / float64(div)
+	// Values that would round up to 1024 are written in the next unit.
+	if v >= unit-0.5 && exp < len("KMGTPE")-1 {
+		v /= unit
+		exp++
+	}
+	// Values that would round up to 10.0 are written without a decimal.
+	if v < 9.95 {
+		return fmt.Sprintf("%.1f%c", v, "KMGTPE"[exp])
+	}
+	return fmt.Sprintf("%.0f%c", v, "KMGTPE"[exp])
+}
+
+// typeMarker returns the marker that `ls -F` writes after a path of the
+// provided mode.
+func typeMarker(mode fs.FileMode) string {
+	switch {
+	case mode.IsDir():
+		return "/"
+	case mode&fs.ModeSymlink != 0:
+		return "@"
+	case mode&fs.ModeNamedPipe != 0:
+		return "|"
+	case mode&fs.ModeSocket != 0:
+		return "="
+	case mode.IsRegular() && mode&0111 != 0:
+		return "*"
+	}
+	return ""
+}
@@ -14,6 +14,10 @@ var (
 	visitFlag     = commander.BoolFlag("cat", 'c', "Run cat command on all files that match")
 	filesOnlyFlag = commander.BoolFlag("file-only", 'f', "Only check file names")
 	dirsOnlyFlag  = commander.BoolFlag("dir-only", 'd', "Only check directory names")
+	// This is separate from depthFlag because 'd' is already used by dirsOnlyFlag.
+	filenameDepthFlag = commander.Flag[int]("depth", commander.FlagNoShortName, "The depth of files to search", commander.NonNegative[int]())
+	print0Flag        = commander.BoolFlag("print0", commander.FlagNoShortName, "Terminate each path with a NUL character instead of a newline (e.g. for `xargs -0`)")
+	fullPathFlag      = commander.BoolFlag("full-path", 'p', "Match against (and highlight matches in) the path of each file relative to the searched directory, rather than just its base name")
 )
 
 func FilenameCLI() *Grep {
@@ -22,23 +26,67 @@ func FilenameCLI() *Grep {
 	}
 }
 
-type filename struct{}
+type filename struct {
+	walkConfig
+	// LastRenames is the undo journal for the last `fp --rename --apply`.
+	LastRenames []*fileRename
+}
 
 func (*filename) Name() string    { return "fp" }
-func (*filename) Changed() bool   { return false }
 func (*filename) Setup() []string { return nil }
 func (*filename) Flags() []commander.FlagInterface {
 	return []commander.FlagInterface{
 		visitFlag,
 		filesOnlyFlag,
 		dirsOnlyFlag,
+		filenameDepthFlag,
+		minDepthFlag,
+		dirFlag,
+		ignoreIgnoreFiles,
+		followFlag,
+		print0Flag,
+		fullPathFlag,
+		longFlag,
+		humanReadableFlag,
+		sortFlag,
+		reverseFlag,
+		execFlag,
+		parallelFlag,
+		failFastFlag,
+		renameFlag,
+		applyFlag,
 	}
 }
-func (*filename) MakeNode(n command.Node) command.Node { return n }
+func (fp *filename) MakeNode(n command.Node) command.Node {
+	return fp.makeNode(n, map[string]command.Node{
+		"undo": commander.SerialNodes(
+			commander.Description("Revert the renames from the last `fp --rename --apply`"),
+			&commander.ExecutorProcessor{F: fp.undoRenames},
+		),
+	})
+}
 
-func (*filename) Process(output command.Output, data *command.Data, f filter, ss *sliceSet) error {
-	cat := data.Bool(visitFlag.Name())
-	return filepath.WalkDir(startDir, func(path string, de fs.DirEntry, err error) error {
+func (fp *filename) Process(output command.Output, data *command.Data, f filter, ss *sliceSet, res *searchResult) error {
+	if err := checkOutputFlags(output, data); err != nil {
+		return err
+	}
+
+	root, err := fp.root(output, data)
+	if err != nil {
+		return err
+	}
+
+	// Matches are only collected (rather than written as they're found) if
+	// they need to be sorted or aligned, or if commands are run on them (or
+	// they are renamed).
+	collect := longFlag.Get(data) || data.Has(sortFlag.Name()) || reverseFlag.Get(data) || data.Has(execFlag.Name()) || data.Has(renameFlag.Name())
+	var matches []*fileMatch
+
+	w, err := fp.newWalker(output, data)
+	if err != nil {
+		return err
+	}
+	w.fn = func(path string, de fs.DirEntry, err error) error {
 		if err != nil {
 			if os.IsNotExist(err) {
 				return output.Stderrf("file not found: %s\n", path)
@@ -46,7 +94,19 @@ func (*filename) Process(output command.Output, data *command.Data, f filter, ss
 			return output.Stderrf("failed to access path %q: %v\n", path, err)
 		}
 
-		formattedString, ok := apply(f, de.Name(), data, ss)
+		// dir is the part of the path that isn't matched (and is printed
+		// uncolored).
+		name, dir := de.Name(), filepath.Dir(path)
+		if fullPathFlag.Get(data) && path != root {
+			// The path is matched relative to the root (which is absolute
+			// for directory aliases).
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return output.Stderrf("failed to get relative path for %q: %v\n", path, err)
+			}
+			name, dir = rel, root
+		}
+		formattedString, ok := apply(f, name, data, ss)
 		if !ok {
 			return nil
 		}
@@ -54,23 +114,110 @@ func (*filename) Process(output command.Output, data *command.Data, f filter, ss
 		if (de.IsDir() && filesOnlyFlag.Get(data)) || (!de.IsDir() && dirsOnlyFlag.Get(data)) {
 			return nil
 		}
+		res.matched = true
+
+		m := &fileMatch{
+			path:            path,
+			name:            name,
+			dir:             dir,
+			formattedString: formattedString,
+			de:              de,
+		}
+		if collect {
+			if m.info, err = de.Info(); err != nil {
+				return output.Stderrf("failed to get file info for %q: %v\n", path, err)
+			}
+			matches = append(matches, m)
+		} else if err := writeMatch(output, data, m, nil); err != nil {
+			return err
+		}
+		if stopAfterMatch(data) {
+			return fs.SkipAll
+		}
+		return nil
+	}
+	if err := w.walk(root); err != nil || !collect {
+		return err
+	}
+
+	sortMatches(data, matches)
+	if data.Has(execFlag.Name()) {
+		return runExec(output, data, matches)
+	}
+	if data.Has(renameFlag.Name()) {
+		return fp.runRename(output, data, root, matches)
+	}
+
+	var columns *longColumns
+	if longFlag.Get(data) {
+		columns = newLongColumns(data, matches)
+	}
+	for _, m := range matches {
+		if err := writeMatch(output, data, m, columns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		if cat {
-			if !de.IsDir() {
-				contents, err := ioutil.ReadFile(path)
-				if err != nil {
-					return output.Stderrf("failed to read file: %v\n", err)
-				}
-				output.Stdoutln(string(contents))
+// checkOutputFlags returns an error if more than one flag that changes how
+// results are written is provided (or if a flag is used with one that it
+// conflicts with).
+func checkOutputFlags(output command.Output, data *command.Data) error {
+	var provided []string
+	for _, f := range []commander.FlagInterface{visitFlag, print0Flag, longFlag, execFlag, renameFlag} {
+		if data.Has(f.Name()) {
+			provided = append(provided, f.Name())
+		}
+	}
+	if len(provided) > 1 {
+		return output.Stderrf("only one of --%s and --%s can be provided\n", provided[0], provided[1])
+	}
+	if applyFlag.Get(data) && !data.Has(renameFlag.Name()) {
+		return output.Stderrf("--%s can only be used with --%s\n", applyFlag.Name(), renameFlag.Name())
+	}
+	// --quiet stops at the first match, so it can't be used with flags that
+	// act on every result.
+	if quietFlag.Get(data) {
+		for _, f := range []commander.FlagInterface{execFlag, renameFlag} {
+			if data.Has(f.Name()) {
+				return output.Stderrf("--%s can't be used with --%s\n", quietFlag.Name(), f.Name())
 			}
-		} else {
-			dir := filepath.Dir(path)
-			if dir != "." {
-				output.Stdoutf("%s%c", dir, filepath.Separator)
+		}
+	}
+	return nil
+}
+
+// writeMatch writes the matching file's path (or its contents if the cat flag
+// is set). If columns is set, then the path is written in long format.
+func writeMatch(output command.Output, data *command.Data, m *fileMatch, columns *longColumns) error {
+	if visitFlag.Get(data) {
+		if !m.de.IsDir() {
+			contents, err := ioutil.ReadFile(m.path)
+			if err != nil {
+				return output.Stderrf("failed to read file: %v\n", err)
 			}
-			applyFormat(output, data, formattedString)
-			output.Stdoutln()
+			output.Stdoutln(string(contents))
 		}
 		return nil
-	})
+	}
+
+	if print0Flag.Get(data) {
+		// Paths are meant to be parsed by another program, so they aren't colored.
+		output.Stdoutf("%s\x00", m.path)
+		return nil
+	}
+
+	if columns != nil {
+		columns.write(output, data, m)
+	}
+	if m.dir != "." && m.dir != "" {
+		output.Stdoutf("%s%c", m.dir, filepath.Separator)
+	}
+	applyFormat(output, data, m.formattedString)
+	if columns != nil {
+		output.Stdout(typeMarker(m.info.Mode()))
+	}
+	output.Stdoutln()
+	return nil
 }
@@ -2,10 +2,16 @@ package grep
 
 import (
 	"fmt"
+	"io/fs"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/leep-frog/command/color"
 	"github.com/leep-frog/command/command"
 	"github.com/leep-frog/command/commandertest"
@@ -28,9 +34,12 @@ func TestFilename(t *testing.T) {
 		commandtest.StubValue(t, &defaultColorValue, sc)
 		fakeColor := fakeColorFn(sc)
 		for _, test := range []struct {
-			name    string
-			etc     *commandtest.ExecuteTestCase
-			stubDir string
+			name           string
+			etc            *commandtest.ExecuteTestCase
+			stubDir        string
+			aliases        map[string]string
+			ignorePatterns map[string]bool
+			wantSettings   *walkSettings
 		}{
 			{
 				name: "returns all files",
@@ -88,6 +97,231 @@ func TestFilename(t *testing.T) {
 					}},
 				},
 			},
+			{
+				name: "returns files up to depth",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"--depth", "1"},
+					WantStdout: strings.Join([]string{
+						"testing",
+						filepath.Join("testing", "lots.txt"),
+						filepath.Join("testing", "numbered.txt"),
+						filepath.Join("testing", "other"),
+						filepath.Join("testing", "that.py"),
+						filepath.Join("testing", "this.txt"),
+						"",
+					}, "\n"),
+					WantData: &command.Data{Values: map[string]interface{}{
+						filenameDepthFlag.Name(): 1,
+					}},
+				},
+			},
+			{
+				name: "returns files from min depth",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"--min-depth", "2"},
+					WantStdout: strings.Join([]string{
+						filepath.Join("testing", "other", "other.txt"),
+						"",
+					}, "\n"),
+					WantData: &command.Data{Values: map[string]interface{}{
+						minDepthFlag.Name(): 2,
+					}},
+				},
+			},
+			{
+				name: "prints NUL-terminated paths",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"t$", "--print0"},
+					WantStdout: strings.Join([]string{
+						filepath.Join("testing", "lots.txt"),
+						filepath.Join("testing", "numbered.txt"),
+						filepath.Join("testing", "other", "other.txt"),
+						filepath.Join("testing", "this.txt"),
+						"",
+					}, "\x00"),
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:    [][]string{{"t$"}},
+						print0Flag.Name(): true,
+					}},
+				},
+			},
+			{
+				name: "prints entire NUL-terminated paths with match-only",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"this", "-o", "--print0"},
+					WantStdout: strings.Join([]string{
+						filepath.Join("testing", "this.txt"),
+						"",
+					}, "\x00"),
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:       [][]string{{"this"}},
+						matchOnlyFlag.Name(): true,
+						print0Flag.Name():    true,
+					}},
+				},
+			},
+			{
+				name: "matches full path",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"other.other", "-p"},
+					WantStdout: strings.Join([]string{
+						"testing" + string(filepath.Separator) + fakeColor(matchColor, filepath.Join("other", "other")) + ".txt",
+						"",
+					}, "\n"),
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:      [][]string{{"other.other"}},
+						fullPathFlag.Name(): true,
+					}},
+				},
+			},
+			{
+				name: "only matches base name by default",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"other.other"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName: [][]string{{"other.other"}},
+					}},
+				},
+			},
+			{
+				name: "matches directories in full path",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^other.o", "--full-path", "-f"},
+					WantStdout: strings.Join([]string{
+						"testing" + string(filepath.Separator) + fakeColor(matchColor, filepath.Join("other", "o")) + "ther.txt",
+						"",
+					}, "\n"),
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:       [][]string{{"^other.o"}},
+						fullPathFlag.Name():  true,
+						filesOnlyFlag.Name(): true,
+					}},
+				},
+			},
+			{
+				name: "prints NUL-terminated full paths",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"r.*t$", "-p", "--print0"},
+					WantStdout: strings.Join([]string{
+						filepath.Join("testing", "numbered.txt"),
+						filepath.Join("testing", "other", "other.txt"),
+						"",
+					}, "\x00"),
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:      [][]string{{"r.*t$"}},
+						fullPathFlag.Name(): true,
+						print0Flag.Name():   true,
+					}},
+				},
+			},
+			{
+				name: "ignore patterns prune directories",
+				ignorePatterns: map[string]bool{
+					`^other$`: true,
+					`\.py$`:   true,
+				},
+				etc: &commandtest.ExecuteTestCase{
+					WantStdout: strings.Join([]string{
+						"testing",
+						filepath.Join("testing", "lots.txt"),
+						filepath.Join("testing", "numbered.txt"),
+						filepath.Join("testing", "this.txt"),
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "ignores ignore patterns",
+				ignorePatterns: map[string]bool{
+					`^other$`: true,
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"other", "-x"},
+					WantStdout: strings.Join([]string{
+						filepath.Join("testing", fakeColor(matchColor, "other")),
+						filepath.Join("testing", "other", fakeColor(matchColor, "other")+".txt"),
+						"",
+					}, "\n"),
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:           [][]string{{"other"}},
+						ignoreIgnoreFiles.Name(): true,
+					}},
+				},
+			},
+			{
+				name: "searches in aliased directory",
+				aliases: map[string]string{
+					"ooo": filepath.Join("testing", "other"),
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-D", "ooo", "-f"},
+					WantStdout: strings.Join([]string{
+						filepath.Join("testing", "other", "other.txt"),
+						"",
+					}, "\n"),
+					WantData: &command.Data{Values: map[string]interface{}{
+						dirFlag.Name():       "ooo",
+						filesOnlyFlag.Name(): true,
+					}},
+				},
+			},
+			{
+				name: "matches full path relative to directory alias",
+				aliases: map[string]string{
+					"t": commandtest.FilepathAbs(t, "testing"),
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{`^other.other\.txt$`, "-p", "-D", "t"},
+					WantStdout: strings.Join([]string{
+						commandtest.FilepathAbs(t, "testing") + string(filepath.Separator) + fakeColor(matchColor, filepath.Join("other", "other.txt")),
+						"",
+					}, "\n"),
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:      [][]string{{`^other.other\.txt$`}},
+						fullPathFlag.Name(): true,
+						dirFlag.Name():      "t",
+					}},
+				},
+			},
+			{
+				name: "errors on unknown directory alias",
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"-D", "ooo"},
+					WantStderr: "unknown alias: \"ooo\"\n",
+					WantErr:    fmt.Errorf(`unknown alias: "ooo"`),
+					WantData: &command.Data{Values: map[string]interface{}{
+						dirFlag.Name(): "ooo",
+					}},
+				},
+			},
+			{
+				name: "adds ignore pattern",
+				ignorePatterns: map[string]bool{
+					`^other$`: true,
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"if", "a", "^node_modules$"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						ignoreFilePattern.Name(): []string{"^node_modules$"},
+					}},
+				},
+				wantSettings: &walkSettings{
+					IgnoreFilePatterns: map[string]bool{
+						`^other$`:        true,
+						`^node_modules$`: true,
+					},
+				},
+			},
+			{
+				name: "lists directory aliases",
+				aliases: map[string]string{
+					"ooo": filepath.Join("testing", "other"),
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"da", "l"},
+					WantStdout: fmt.Sprintf("ooo: %s\n", filepath.Join("testing", "other")),
+				},
+			},
 			{
 				name:    "errors on walk error",
 				stubDir: "does-not-exist",
@@ -231,10 +465,27 @@ func TestFilename(t *testing.T) {
 				commandtest.StubValue(t, &startDir, tmpStart)
 
 				// Run the test.
-				f := FilenameCLI()
+				settings := &walkSettings{
+					DirectoryAliases:   test.aliases,
+					IgnoreFilePatterns: test.ignorePatterns,
+				}
+				getSettings := stubWalkSettings(t, settings)
+
+				f := &Grep{
+					InputSource: &filename{},
+				}
 				test.etc.Node = f.Node()
 				commandertest.ExecuteTest(t, test.etc)
 				commandertest.ChangeTest(t, nil, f)
+
+				// Settings are only saved in the shared store.
+				wantSettings := test.wantSettings
+				if wantSettings == nil {
+					wantSettings = settings
+				}
+				if diff := cmp.Diff(wantSettings, getSettings(), cmpopts.EquateEmpty()); diff != "" {
+					t.Errorf("fp produced incorrect walk settings (-want, +got):\n%s", diff)
+				}
 			})
 		}
 	}
@@ -252,3 +503,939 @@ func TestFilenameMetadata(t *testing.T) {
 		t.Errorf("Filename.Setup() returned %v; want nil", c.Setup())
 	}
 }
+
+func TestFilenameLong(t *testing.T) {
+	// Create files with known sizes, modes, and modification times.
+	root := t.TempDir()
+	for _, f := range []struct {
+		path  string
+		size  int
+		mode  os.FileMode
+		mtime int64
+	}{
+		{filepath.Join("sub", "small.txt"), 1, 0644, 1700000000},
+		{"big.txt", 2048, 0644, 1700000100},
+		{"run.sh", 10, 0755, 1700000200},
+	} {
+		path := filepath.Join(root, f.path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(strings.Repeat("a", f.size)), f.mode); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		if err := os.Chmod(path, f.mode); err != nil {
+			t.Fatalf("failed to change file mode: %v", err)
+		}
+		if err := os.Chtimes(path, time.Unix(f.mtime, 0), time.Unix(f.mtime, 0)); err != nil {
+			t.Fatalf("failed to change file times: %v", err)
+		}
+	}
+	// Directory sizes depend on the file system.
+	sub := filepath.Join(root, "sub")
+	if err := os.Chtimes(sub, time.Unix(1700000300, 0), time.Unix(1700000300, 0)); err != nil {
+		t.Fatalf("failed to change directory times: %v", err)
+	}
+	subInfo, err := os.Stat(sub)
+	if err != nil {
+		t.Fatalf("failed to stat directory: %v", err)
+	}
+
+	mtime := func(sec int64) string {
+		return time.Unix(sec, 0).Format(mtimeFormat)
+	}
+
+	for _, sc := range []bool{true, false} {
+		commandtest.StubValue(t, &defaultColorValue, sc)
+		fakeColor := fakeColorFn(sc)
+		long := func(mode, size string, sec int64, path ...string) string {
+			return fmt.Sprintf("%s %s %s %s", mode, size, fakeColor(timestampColor, mtime(sec)), filepath.Join(append([]string{root}, path...)...))
+		}
+		for _, test := range []struct {
+			name string
+			etc  *commandtest.ExecuteTestCase
+		}{
+			{
+				name: "lists files in long format",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-f", "--long"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						filesOnlyFlag.Name(): true,
+						longFlag.Name():      true,
+					}},
+					WantStdout: strings.Join([]string{
+						long("-rw-r--r--", "2048", 1700000100, "big.txt"),
+						long("-rwxr-xr-x", "  10", 1700000200, "run.sh*"),
+						long("-rw-r--r--", "   1", 1700000000, "sub", "small.txt"),
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "lists files with human-readable sizes",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-f", "-l", "-h"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						filesOnlyFlag.Name():     true,
+						longFlag.Name():          true,
+						humanReadableFlag.Name(): true,
+					}},
+					WantStdout: strings.Join([]string{
+						long("-rw-r--r--", "2.0K", 1700000100, "big.txt"),
+						long("-rwxr-xr-x", "  10", 1700000200, "run.sh*"),
+						long("-rw-r--r--", "   1", 1700000000, "sub", "small.txt"),
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "marks directories",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^sub$", "-l"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:  [][]string{{"^sub$"}},
+						longFlag.Name(): true,
+					}},
+					WantStdout: fmt.Sprintf("%s %d %s %s%c%s/\n", subInfo.Mode(), subInfo.Size(), fakeColor(timestampColor, mtime(1700000300)), root, filepath.Separator, fakeColor(matchColor, "sub")),
+				},
+			},
+			{
+				name: "sorts by size",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-f", "--sort", "size"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						filesOnlyFlag.Name(): true,
+						sortFlag.Name():      "size",
+					}},
+					WantStdout: strings.Join([]string{
+						filepath.Join(root, "big.txt"),
+						filepath.Join(root, "run.sh"),
+						filepath.Join(root, "sub", "small.txt"),
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "sorts by mtime",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-f", "-s", "mtime"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						filesOnlyFlag.Name(): true,
+						sortFlag.Name():      "mtime",
+					}},
+					WantStdout: strings.Join([]string{
+						filepath.Join(root, "run.sh"),
+						filepath.Join(root, "big.txt"),
+						filepath.Join(root, "sub", "small.txt"),
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "sorts by name in reverse",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-f", "-s", "name", "-r"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						filesOnlyFlag.Name(): true,
+						sortFlag.Name():      "name",
+						reverseFlag.Name():   true,
+					}},
+					WantStdout: strings.Join([]string{
+						filepath.Join(root, "sub", "small.txt"),
+						filepath.Join(root, "run.sh"),
+						filepath.Join(root, "big.txt"),
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "sorts in long format",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-f", "-l", "-s", "mtime", "--reverse"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						filesOnlyFlag.Name(): true,
+						longFlag.Name():      true,
+						sortFlag.Name():      "mtime",
+						reverseFlag.Name():   true,
+					}},
+					WantStdout: strings.Join([]string{
+						long("-rw-r--r--", "   1", 1700000000, "sub", "small.txt"),
+						long("-rw-r--r--", "2048", 1700000100, "big.txt"),
+						long("-rwxr-xr-x", "  10", 1700000200, "run.sh*"),
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "errors on invalid sort",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-s", "age"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						sortFlag.Name(): "age",
+					}},
+					WantStderr: "validation for \"sort\" failed: [InList] argument must be one of [name size mtime]\n",
+					WantErr:    fmt.Errorf("validation for \"sort\" failed: [InList] argument must be one of [name size mtime]"),
+				},
+			},
+			{
+				name: "errors on long with cat",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-l", "-c"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						longFlag.Name():  true,
+						visitFlag.Name(): true,
+					}},
+					WantStderr: "only one of --cat and --long can be provided\n",
+					WantErr:    fmt.Errorf("only one of --cat and --long can be provided"),
+				},
+			},
+			{
+				name: "errors on long with print0",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-l", "--print0"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						longFlag.Name():   true,
+						print0Flag.Name(): true,
+					}},
+					WantStderr: "only one of --print0 and --long can be provided\n",
+					WantErr:    fmt.Errorf("only one of --print0 and --long can be provided"),
+				},
+			},
+			/* Useful for commenting out tests. */
+		} {
+			t.Run(testName(sc, test.name), func(t *testing.T) {
+				commandtest.StubValue(t, &startDir, root)
+				stubWalkSettings(t, &walkSettings{})
+				f := FilenameCLI()
+				test.etc.Node = f.Node()
+				commandertest.ExecuteTest(t, test.etc)
+				commandertest.ChangeTest(t, nil, f)
+			})
+		}
+	}
+}
+
+func TestFilenameExec(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.go", "b.go", "fail.go", "notes.txt", "z.go"} {
+		if err := os.WriteFile(filepath.Join(root, name), nil, 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+	path := func(name string) string {
+		return filepath.Join(root, name)
+	}
+
+	for _, sc := range []bool{true, false} {
+		commandtest.StubValue(t, &defaultColorValue, sc)
+		fakeColor := fakeColorFn(sc)
+		// prefixed returns the command output line as written by fp.
+		prefixed := func(name, line string) string {
+			return fmt.Sprintf("%s: %s", fakeColor(fileColor, path(name)), line)
+		}
+		for _, test := range []struct {
+			name      string
+			etc       *commandtest.ExecuteTestCase
+			wantCalls [][]string
+		}{
+			{
+				name: "runs command for each result",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{`^[ab]\.go$`, "--exec", "echo {}"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:  [][]string{{`^[ab]\.go$`}},
+						execFlag.Name(): "echo {}",
+					}},
+					WantStdout: strings.Join([]string{
+						prefixed("a.go", "echo "+path("a.go")),
+						prefixed("b.go", "echo "+path("b.go")),
+						"",
+					}, "\n"),
+				},
+				wantCalls: [][]string{
+					{"echo", path("a.go")},
+					{"echo", path("b.go")},
+				},
+			},
+			{
+				name: "replaces capture groups",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{`^([ab])\.(go)$`, "-e", "mv {} '{1} copy.{2}'"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:  [][]string{{`^([ab])\.(go)$`}},
+						execFlag.Name(): "mv {} '{1} copy.{2}'",
+					}},
+					WantStdout: strings.Join([]string{
+						prefixed("a.go", fmt.Sprintf("mv %s a copy.go", path("a.go"))),
+						prefixed("b.go", fmt.Sprintf("mv %s b copy.go", path("b.go"))),
+						"",
+					}, "\n"),
+				},
+				wantCalls: [][]string{
+					{"mv", path("a.go"), "a copy.go"},
+					{"mv", path("b.go"), "b copy.go"},
+				},
+			},
+			{
+				name: "runs batched command once",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{`^[ab]\.go$`, "-e", "wc -l {} +"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:  [][]string{{`^[ab]\.go$`}},
+						execFlag.Name(): "wc -l {} +",
+					}},
+					WantStdout: fmt.Sprintf("wc -l %s %s\n", path("a.go"), path("b.go")),
+				},
+				wantCalls: [][]string{
+					{"wc", "-l", path("a.go"), path("b.go")},
+				},
+			},
+			{
+				name: "doesn't run batched command if no results",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"nothing", "-e", "wc -l {} +"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:  [][]string{{"nothing"}},
+						execFlag.Name(): "wc -l {} +",
+					}},
+				},
+			},
+			{
+				name: "errors if batched command has other placeholders",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{`\.go$`, "-e", "cp {1} {} +"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:  [][]string{{`\.go$`}},
+						execFlag.Name(): "cp {1} {} +",
+					}},
+					WantStderr: "invalid exec command: `{} +` must be the only placeholder\n",
+					WantErr:    fmt.Errorf("invalid exec command: `{} +` must be the only placeholder"),
+				},
+			},
+			{
+				name: "errors on missing capture group",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{`^(a)\.go$`, "-e", "echo {2}"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:  [][]string{{`^(a)\.go$`}},
+						execFlag.Name(): "echo {2}",
+					}},
+					WantStderr: fmt.Sprintf("capture group {2} doesn't exist for %q\n", path("a.go")),
+					WantErr:    fmt.Errorf("capture group {2} doesn't exist for %q", path("a.go")),
+				},
+			},
+			{
+				name: "errors on unterminated quote",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{`\.go$`, "-e", "echo '{}"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:  [][]string{{`\.go$`}},
+						execFlag.Name(): "echo '{}",
+					}},
+					WantStderr: "invalid exec command: unterminated ' quote\n",
+					WantErr:    fmt.Errorf("invalid exec command: unterminated ' quote"),
+				},
+			},
+			{
+				name: "errors on empty command",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{`\.go$`, "-e", " "},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:  [][]string{{`\.go$`}},
+						execFlag.Name(): " ",
+					}},
+					WantStderr: "invalid exec command: empty command\n",
+					WantErr:    fmt.Errorf("invalid exec command: empty command"),
+				},
+			},
+			{
+				name: "continues after failures",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{`\.go$`, "-e", "echo {}"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:  [][]string{{`\.go$`}},
+						execFlag.Name(): "echo {}",
+					}},
+					WantStdout: strings.Join([]string{
+						prefixed("a.go", "echo "+path("a.go")),
+						prefixed("b.go", "echo "+path("b.go")),
+						prefixed("z.go", "echo "+path("z.go")),
+						"",
+					}, "\n"),
+					WantStderr: strings.Join([]string{
+						fmt.Sprintf("%s: oops", path("fail.go")),
+						fmt.Sprintf("%s: command failed: exit status 1", path("fail.go")),
+						"1 of 4 commands failed",
+						"",
+					}, "\n"),
+					WantErr: fmt.Errorf("1 of 4 commands failed"),
+				},
+				wantCalls: [][]string{
+					{"echo", path("a.go")},
+					{"echo", path("b.go")},
+					{"echo", path("fail.go")},
+					{"echo", path("z.go")},
+				},
+			},
+			{
+				name: "stops after first failure",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{`\.go$`, "-e", "echo {}", "--fail-fast"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:      [][]string{{`\.go$`}},
+						execFlag.Name():     "echo {}",
+						failFastFlag.Name(): true,
+					}},
+					WantStdout: strings.Join([]string{
+						prefixed("a.go", "echo "+path("a.go")),
+						prefixed("b.go", "echo "+path("b.go")),
+						"",
+					}, "\n"),
+					WantStderr: strings.Join([]string{
+						fmt.Sprintf("%s: oops", path("fail.go")),
+						fmt.Sprintf("%s: command failed: exit status 1", path("fail.go")),
+						"1 of 4 commands failed",
+						"",
+					}, "\n"),
+					WantErr: fmt.Errorf("1 of 4 commands failed"),
+				},
+				wantCalls: [][]string{
+					{"echo", path("a.go")},
+					{"echo", path("b.go")},
+					{"echo", path("fail.go")},
+				},
+			},
+			{
+				name: "writes parallel output in order",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{`^[abz]\.go$`, "-e", "echo {}", "-P", "3"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:      [][]string{{`^[abz]\.go$`}},
+						execFlag.Name():     "echo {}",
+						parallelFlag.Name(): 3,
+					}},
+					WantStdout: strings.Join([]string{
+						prefixed("a.go", "echo "+path("a.go")),
+						prefixed("b.go", "echo "+path("b.go")),
+						prefixed("z.go", "echo "+path("z.go")),
+						"",
+					}, "\n"),
+				},
+				wantCalls: [][]string{
+					{"echo", path("a.go")},
+					{"echo", path("b.go")},
+					{"echo", path("z.go")},
+				},
+			},
+			{
+				name: "errors on non-positive parallel",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-e", "echo {}", "-P", "0"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						execFlag.Name():     "echo {}",
+						parallelFlag.Name(): 0,
+					}},
+					WantStderr: "validation for \"parallel\" failed: [Positive] value isn't positive\n",
+					WantErr:    fmt.Errorf("validation for \"parallel\" failed: [Positive] value isn't positive"),
+				},
+			},
+			{
+				name: "errors on exec with cat",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-c", "-e", "echo {}"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						visitFlag.Name(): true,
+						execFlag.Name():  "echo {}",
+					}},
+					WantStderr: "only one of --cat and --exec can be provided\n",
+					WantErr:    fmt.Errorf("only one of --cat and --exec can be provided"),
+				},
+			},
+			{
+				name: "errors on exec with quiet",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-q", "-e", "echo {}"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						quietFlag.Name(): true,
+						execFlag.Name():  "echo {}",
+					}},
+					WantStderr: "--quiet can't be used with --exec\n",
+					WantErr:    fmt.Errorf("--quiet can't be used with --exec"),
+				},
+			},
+			/* Useful for commenting out tests. */
+		} {
+			t.Run(testName(sc, test.name), func(t *testing.T) {
+				commandtest.StubValue(t, &startDir, root)
+				stubWalkSettings(t, &walkSettings{})
+				var mu sync.Mutex
+				var gotCalls [][]string
+				commandtest.StubValue(t, &runCommand, func(args []string) ([]byte, []byte, error) {
+					mu.Lock()
+					gotCalls = append(gotCalls, args)
+					mu.Unlock()
+					for _, arg := range args {
+						if strings.Contains(arg, "fail") {
+							return nil, []byte("oops\n"), fmt.Errorf("exit status 1")
+						}
+					}
+					return []byte(strings.Join(args, " ") + "\n"), nil, nil
+				})
+
+				f := FilenameCLI()
+				test.etc.Node = f.Node()
+				commandertest.ExecuteTest(t, test.etc)
+				commandertest.ChangeTest(t, nil, f)
+
+				// Parallel commands can be started in any order.
+				sortCalls := cmpopts.SortSlices(func(a, b []string) bool { return strings.Join(a, " ") < strings.Join(b, " ") })
+				if diff := cmp.Diff(test.wantCalls, gotCalls, sortCalls); diff != "" {
+					t.Errorf("fp --exec ran incorrect commands (-want, +got):\n%s", diff)
+				}
+			})
+		}
+	}
+}
+
+func TestFilenameRename(t *testing.T) {
+	// The directory is recreated for each test, since tests rename files.
+	root := t.TempDir()
+	path := func(parts ...string) string {
+		return filepath.Join(append([]string{root}, parts...)...)
+	}
+	sqlFiles := []string{"foo_v1_a.sql", "foo_v1_b.sql", "other.txt", filepath.Join("sub", "foo_v1_c.sql")}
+	// row returns a line of the rename table.
+	row := func(oldPath, newPath, note string) string {
+		s := fmt.Sprintf("%-*s -> %s", len(path("sub", "foo_v1_c.sql")), oldPath, newPath)
+		if note != "" {
+			s += fmt.Sprintf(" (%s)", note)
+		}
+		return s
+	}
+
+	for _, test := range []struct {
+		name      string
+		files     []string
+		aliases   map[string]string
+		journal   []*fileRename
+		renameErr string
+		etc       *commandtest.ExecuteTestCase
+		want      *filename
+		wantFiles []string
+	}{
+		{
+			name:  "shows renames without applying them",
+			files: sqlFiles,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{`^foo_v1_(.*)\.sql$`, "--rename", "foo_v2_{1}.sql"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					patternArgName:    [][]string{{`^foo_v1_(.*)\.sql$`}},
+					renameFlag.Name(): "foo_v2_{1}.sql",
+				}},
+				WantStdout: strings.Join([]string{
+					row(path("foo_v1_a.sql"), path("foo_v2_a.sql"), ""),
+					row(path("foo_v1_b.sql"), path("foo_v2_b.sql"), ""),
+					row(path("sub", "foo_v1_c.sql"), path("sub", "foo_v2_c.sql"), ""),
+					"3 files would be renamed (run again with --apply to rename them)",
+					"",
+				}, "\n"),
+			},
+			wantFiles: sqlFiles,
+		},
+		{
+			name:  "applies renames",
+			files: sqlFiles,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{`^foo_v1_(.*)\.sql$`, "--rename", "foo_v2_{1}.sql", "--apply"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					patternArgName:    [][]string{{`^foo_v1_(.*)\.sql$`}},
+					renameFlag.Name(): "foo_v2_{1}.sql",
+					applyFlag.Name():  true,
+				}},
+				WantStdout: strings.Join([]string{
+					row(path("foo_v1_a.sql"), path("foo_v2_a.sql"), ""),
+					row(path("foo_v1_b.sql"), path("foo_v2_b.sql"), ""),
+					row(path("sub", "foo_v1_c.sql"), path("sub", "foo_v2_c.sql"), ""),
+					"Renamed 3 files (run `fp undo` to revert them)",
+					"",
+				}, "\n"),
+			},
+			want: &filename{LastRenames: []*fileRename{
+				{path("sub", "foo_v1_c.sql"), path("sub", "foo_v2_c.sql")},
+				{path("foo_v1_a.sql"), path("foo_v2_a.sql")},
+				{path("foo_v1_b.sql"), path("foo_v2_b.sql")},
+			}},
+			wantFiles: []string{"foo_v2_a.sql", "foo_v2_b.sql", "other.txt", filepath.Join("sub", "foo_v2_c.sql")},
+		},
+		{
+			name:  "replaces the journal",
+			files: []string{"a.txt"},
+			journal: []*fileRename{
+				{path("old.txt"), path("new.txt")},
+			},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{`^(a)\.txt$`, "--rename", "{1}.md", "--apply"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					patternArgName:    [][]string{{`^(a)\.txt$`}},
+					renameFlag.Name(): "{1}.md",
+					applyFlag.Name():  true,
+				}},
+				WantStdout: strings.Join([]string{
+					fmt.Sprintf("%s -> %s", path("a.txt"), path("a.md")),
+					"Renamed 1 files (run `fp undo` to revert them)",
+					"",
+				}, "\n"),
+			},
+			want: &filename{LastRenames: []*fileRename{
+				{path("a.txt"), path("a.md")},
+			}},
+			wantFiles: []string{"a.md"},
+		},
+		{
+			name:  "renames files before their directories",
+			files: []string{filepath.Join("dir_v1", "file_v1.txt")},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{`^(.*)_v1(.*)$`, "--rename", "{1}_v2{2}", "--apply"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					patternArgName:    [][]string{{`^(.*)_v1(.*)$`}},
+					renameFlag.Name(): "{1}_v2{2}",
+					applyFlag.Name():  true,
+				}},
+				WantStdout: strings.Join([]string{
+					fmt.Sprintf("%-*s -> %s", len(path("dir_v1", "file_v1.txt")), path("dir_v1"), path("dir_v2")),
+					fmt.Sprintf("%s -> %s", path("dir_v1", "file_v1.txt"), path("dir_v1", "file_v2.txt")),
+					"Renamed 2 files (run `fp undo` to revert them)",
+					"",
+				}, "\n"),
+			},
+			want: &filename{LastRenames: []*fileRename{
+				{path("dir_v1", "file_v1.txt"), path("dir_v1", "file_v2.txt")},
+				{path("dir_v1"), path("dir_v2")},
+			}},
+			wantFiles: []string{filepath.Join("dir_v2", "file_v2.txt")},
+		},
+		{
+			name:  "moves files into new directories with full path",
+			files: sqlFiles,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{`^sub/(.*)$`, "--full-path", "--rename", "moved/{1}", "--apply"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					patternArgName:      [][]string{{`^sub/(.*)$`}},
+					fullPathFlag.Name(): true,
+					renameFlag.Name():   "moved/{1}",
+					applyFlag.Name():    true,
+				}},
+				WantStdout: strings.Join([]string{
+					fmt.Sprintf("%s -> %s", path("sub", "foo_v1_c.sql"), path("moved", "foo_v1_c.sql")),
+					"Renamed 1 files (run `fp undo` to revert them)",
+					"",
+				}, "\n"),
+			},
+			want: &filename{LastRenames: []*fileRename{
+				{path("sub", "foo_v1_c.sql"), path("moved", "foo_v1_c.sql")},
+			}},
+			wantFiles: []string{"foo_v1_a.sql", "foo_v1_b.sql", filepath.Join("moved", "foo_v1_c.sql"), "other.txt"},
+		},
+		{
+			name:    "renames full paths relative to directory alias",
+			files:   sqlFiles,
+			aliases: map[string]string{"s": path("sub")},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{`^foo_v1_(.*)\.sql$`, "-D", "s", "--full-path", "--rename", "renamed/{1}.sql", "--apply"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					patternArgName:      [][]string{{`^foo_v1_(.*)\.sql$`}},
+					dirFlag.Name():      "s",
+					fullPathFlag.Name(): true,
+					renameFlag.Name():   "renamed/{1}.sql",
+					applyFlag.Name():    true,
+				}},
+				WantStdout: strings.Join([]string{
+					fmt.Sprintf("%s -> %s", path("sub", "foo_v1_c.sql"), path("sub", "renamed", "c.sql")),
+					"Renamed 1 files (run `fp undo` to revert them)",
+					"",
+				}, "\n"),
+			},
+			want: &filename{LastRenames: []*fileRename{
+				{path("sub", "foo_v1_c.sql"), path("sub", "renamed", "c.sql")},
+			}},
+			wantFiles: []string{"foo_v1_a.sql", "foo_v1_b.sql", "other.txt", filepath.Join("sub", "renamed", "c.sql")},
+		},
+		{
+			name:  "skips unchanged names",
+			files: sqlFiles,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{`^foo_v1_(a|b)\.sql$`, "--rename", "foo_v1_{1}.sql", "--apply"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					patternArgName:    [][]string{{`^foo_v1_(a|b)\.sql$`}},
+					renameFlag.Name(): "foo_v1_{1}.sql",
+					applyFlag.Name():  true,
+				}},
+				WantStdout: strings.Join([]string{
+					fmt.Sprintf("%s -> %s (unchanged)", path("foo_v1_a.sql"), path("foo_v1_a.sql")),
+					fmt.Sprintf("%s -> %s (unchanged)", path("foo_v1_b.sql"), path("foo_v1_b.sql")),
+					"",
+				}, "\n"),
+			},
+			wantFiles: sqlFiles,
+		},
+		{
+			name:  "doesn't rename anything if names collide",
+			files: sqlFiles,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{`^foo_v1_.*\.sql$`, "--rename", "foo_v2.sql", "--apply"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					patternArgName:    [][]string{{`^foo_v1_.*\.sql$`}},
+					renameFlag.Name(): "foo_v2.sql",
+					applyFlag.Name():  true,
+				}},
+				WantStdout: strings.Join([]string{
+					row(path("foo_v1_a.sql"), path("foo_v2.sql"), "collides with another rename"),
+					row(path("foo_v1_b.sql"), path("foo_v2.sql"), "collides with another rename"),
+					row(path("sub", "foo_v1_c.sql"), path("sub", "foo_v2.sql"), ""),
+					"",
+				}, "\n"),
+				WantStderr: "2 of 3 renames conflict; no files were renamed\n",
+				WantErr:    fmt.Errorf("2 of 3 renames conflict; no files were renamed"),
+			},
+			wantFiles: sqlFiles,
+		},
+		{
+			name:  "doesn't rename anything if a file would be overwritten",
+			files: append([]string{"foo_v2_b.sql"}, sqlFiles...),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{`^foo_v1_(.*)\.sql$`, "--rename", "foo_v2_{1}.sql", "--apply"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					patternArgName:    [][]string{{`^foo_v1_(.*)\.sql$`}},
+					renameFlag.Name(): "foo_v2_{1}.sql",
+					applyFlag.Name():  true,
+				}},
+				WantStdout: strings.Join([]string{
+					row(path("foo_v1_a.sql"), path("foo_v2_a.sql"), ""),
+					row(path("foo_v1_b.sql"), path("foo_v2_b.sql"), "would overwrite an existing file"),
+					row(path("sub", "foo_v1_c.sql"), path("sub", "foo_v2_c.sql"), ""),
+					"",
+				}, "\n"),
+				WantStderr: "1 of 3 renames conflict; no files were renamed\n",
+				WantErr:    fmt.Errorf("1 of 3 renames conflict; no files were renamed"),
+			},
+			wantFiles: []string{"foo_v1_a.sql", "foo_v1_b.sql", "foo_v2_b.sql", "other.txt", filepath.Join("sub", "foo_v1_c.sql")},
+		},
+		{
+			name:      "keeps journal of renames before a failure",
+			files:     sqlFiles,
+			renameErr: "foo_v1_b",
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{`^foo_v1_(.*)\.sql$`, "--rename", "foo_v2_{1}.sql", "--apply"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					patternArgName:    [][]string{{`^foo_v1_(.*)\.sql$`}},
+					renameFlag.Name(): "foo_v2_{1}.sql",
+					applyFlag.Name():  true,
+				}},
+				WantStdout: strings.Join([]string{
+					row(path("foo_v1_a.sql"), path("foo_v2_a.sql"), ""),
+					row(path("foo_v1_b.sql"), path("foo_v2_b.sql"), ""),
+					row(path("sub", "foo_v1_c.sql"), path("sub", "foo_v2_c.sql"), ""),
+					"",
+				}, "\n"),
+				WantStderr: fmt.Sprintf("failed to rename %q: oops (renamed 2 of 3 files; run `fp undo` to revert them)\n", path("foo_v1_b.sql")),
+				WantErr:    fmt.Errorf("failed to rename %q: oops (renamed 2 of 3 files; run `fp undo` to revert them)", path("foo_v1_b.sql")),
+			},
+			want: &filename{LastRenames: []*fileRename{
+				{path("sub", "foo_v1_c.sql"), path("sub", "foo_v2_c.sql")},
+				{path("foo_v1_a.sql"), path("foo_v2_a.sql")},
+			}},
+			wantFiles: []string{"foo_v1_b.sql", "foo_v2_a.sql", "other.txt", filepath.Join("sub", "foo_v2_c.sql")},
+		},
+		{
+			name:  "errors on missing capture group",
+			files: sqlFiles,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{`^foo_v1_(a)\.sql$`, "--rename", "{2}.sql"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					patternArgName:    [][]string{{`^foo_v1_(a)\.sql$`}},
+					renameFlag.Name(): "{2}.sql",
+				}},
+				WantStderr: "capture group {2} doesn't exist for \"foo_v1_a.sql\"\n",
+				WantErr:    fmt.Errorf("capture group {2} doesn't exist for \"foo_v1_a.sql\""),
+			},
+			wantFiles: sqlFiles,
+		},
+		{
+			name:  "errors on empty name",
+			files: sqlFiles,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{`^foo_v1_(x?)a\.sql$`, "--rename", "{1}"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					patternArgName:    [][]string{{`^foo_v1_(x?)a\.sql$`}},
+					renameFlag.Name(): "{1}",
+				}},
+				WantStderr: fmt.Sprintf("rename template produced an empty name for %q\n", path("foo_v1_a.sql")),
+				WantErr:    fmt.Errorf("rename template produced an empty name for %q", path("foo_v1_a.sql")),
+			},
+			wantFiles: sqlFiles,
+		},
+		{
+			name:  "errors on apply without rename",
+			files: sqlFiles,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"--apply"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					applyFlag.Name(): true,
+				}},
+				WantStderr: "--apply can only be used with --rename\n",
+				WantErr:    fmt.Errorf("--apply can only be used with --rename"),
+			},
+			wantFiles: sqlFiles,
+		},
+		{
+			name:  "errors on rename with exec",
+			files: sqlFiles,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"-e", "echo {}", "--rename", "{}"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					execFlag.Name():   "echo {}",
+					renameFlag.Name(): "{}",
+				}},
+				WantStderr: "only one of --exec and --rename can be provided\n",
+				WantErr:    fmt.Errorf("only one of --exec and --rename can be provided"),
+			},
+			wantFiles: sqlFiles,
+		},
+		{
+			name:  "errors on rename with quiet",
+			files: sqlFiles,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"-q", "--rename", "{}", "--apply"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					quietFlag.Name():  true,
+					renameFlag.Name(): "{}",
+					applyFlag.Name():  true,
+				}},
+				WantStderr: "--quiet can't be used with --rename\n",
+				WantErr:    fmt.Errorf("--quiet can't be used with --rename"),
+			},
+			wantFiles: sqlFiles,
+		},
+		// fp undo
+		{
+			name:  "undoes renames",
+			files: []string{filepath.Join("dir_v2", "file_v2.txt")},
+			journal: []*fileRename{
+				{path("dir_v1", "file_v1.txt"), path("dir_v1", "file_v2.txt")},
+				{path("dir_v1"), path("dir_v2")},
+			},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"undo"},
+				WantStdout: "Reverted 2 renames\n",
+			},
+			want:      &filename{},
+			wantFiles: []string{filepath.Join("dir_v1", "file_v1.txt")},
+		},
+		{
+			name:  "undo stops if a file would be overwritten",
+			files: []string{"foo_v1_a.sql", "foo_v2_a.sql", "foo_v2_b.sql"},
+			journal: []*fileRename{
+				{path("foo_v1_a.sql"), path("foo_v2_a.sql")},
+				{path("foo_v1_b.sql"), path("foo_v2_b.sql")},
+			},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"undo"},
+				WantStderr: fmt.Sprintf("failed to undo rename of %q: %q already exists (reverted 1 files)\n", path("foo_v2_a.sql"), path("foo_v1_a.sql")),
+				WantErr:    fmt.Errorf("failed to undo rename of %q: %q already exists (reverted 1 files)", path("foo_v2_a.sql"), path("foo_v1_a.sql")),
+			},
+			want: &filename{LastRenames: []*fileRename{
+				{path("foo_v1_a.sql"), path("foo_v2_a.sql")},
+			}},
+			wantFiles: []string{"foo_v1_a.sql", "foo_v1_b.sql", "foo_v2_a.sql"},
+		},
+		{
+			name: "undo errors if there are no renames",
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"undo"},
+				WantStderr: "there are no renames to undo\n",
+				WantErr:    fmt.Errorf("there are no renames to undo"),
+			},
+		},
+		/* Useful for commenting out tests. */
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stubWalkSettings(t, &walkSettings{DirectoryAliases: test.aliases})
+			if err := os.RemoveAll(root); err != nil {
+				t.Fatalf("failed to remove directory: %v", err)
+			}
+			if err := os.Mkdir(root, 0755); err != nil {
+				t.Fatalf("failed to create directory: %v", err)
+			}
+			for _, f := range test.files {
+				if err := os.MkdirAll(filepath.Dir(path(f)), 0755); err != nil {
+					t.Fatalf("failed to create directory: %v", err)
+				}
+				if err := os.WriteFile(path(f), nil, 0644); err != nil {
+					t.Fatalf("failed to write file: %v", err)
+				}
+			}
+			commandtest.StubValue(t, &startDir, root)
+			if test.renameErr != "" {
+				commandtest.StubValue(t, &osRename, func(oldPath, newPath string) error {
+					if strings.Contains(oldPath, test.renameErr) {
+						return fmt.Errorf("oops")
+					}
+					return os.Rename(oldPath, newPath)
+				})
+			}
+
+			f := &Grep{
+				InputSource: &filename{LastRenames: test.journal},
+			}
+			var g *Grep
+			if test.want != nil {
+				g = &Grep{
+					InputSource: test.want,
+				}
+			}
+			test.etc.Node = f.Node()
+			commandertest.ExecuteTest(t, test.etc)
+			commandertest.ChangeTest(t, g, f, cmp.AllowUnexported(filename{}), cmpopts.IgnoreUnexported(walkConfig{}, Grep{}))
+
+			var gotFiles []string
+			if err := filepath.WalkDir(root, func(p string, de fs.DirEntry, err error) error {
+				if err != nil || de.IsDir() {
+					return err
+				}
+				rel, err := filepath.Rel(root, p)
+				gotFiles = append(gotFiles, rel)
+				return err
+			}); err != nil {
+				t.Fatalf("failed to walk directory: %v", err)
+			}
+			if diff := cmp.Diff(test.wantFiles, gotFiles); diff != "" {
+				t.Errorf("fp --rename produced incorrect files (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	for _, test := range []struct {
+		size int64
+		want string
+	}{
+		{0, "0"},
+		{1023, "1023"},
+		{1024, "1.0K"},
+		{1536, "1.5K"},
+		{10150, "9.9K"},
+		{10200, "10K"},
+		{1047961, "1023K"},
+		{1048064, "1.0M"},
+		{1048575, "1.0M"},
+		{1048576, "1.0M"},
+		{5 * 1024 * 1024 * 1024, "5.0G"},
+	} {
+		t.Run(fmt.Sprint(test.size), func(t *testing.T) {
+			if got := humanSize(test.size); got != test.want {
+				t.Errorf("humanSize(%d) returned %q; want %q", test.size, got, test.want)
+			}
+		})
+	}
+}
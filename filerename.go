@@ -0,0 +1,179 @@
+package grep
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+var (
+	renameFlag = commander.Flag[string]("rename", commander.FlagNoShortName, "Rename each result to this template. `{}` is replaced with the matched name and `{N}` with the Nth capture group of the first pattern that matches. The new name is relative to the result's directory (or, if --full-path is set, to the walked directory unless it's absolute). Renames are only shown unless --apply is provided")
+	applyFlag  = commander.BoolFlag("apply", commander.FlagNoShortName, "Perform the renames from --rename (which can be reverted with `fp undo`)")
+
+	osRename   = os.Rename
+	osMkdirAll = os.MkdirAll
+)
+
+// fileRename is a rename that was performed by `fp --rename --apply`.
+type fileRename struct {
+	// Old and New are absolute paths.
+	Old string
+	New string
+}
+
+// renameOp is a rename that would be performed for a result.
+type renameOp struct {
+	oldPath string
+	newPath string
+	// oldAbs and newAbs are used to compare paths and for the undo journal.
+	oldAbs string
+	newAbs string
+	// note is written after the rename in the table.
+	note     string
+	conflict bool
+}
+
+func (op *renameOp) unchanged() bool {
+	return op.oldAbs == op.newAbs
+}
+
+// renameOps returns the renames for the matches (in the walked root
+// directory), with any collisions and overwrites marked as conflicts.
+func renameOps(data *command.Data, root string, matches []*fileMatch) ([]*renameOp, error) {
+	template := renameFlag.Get(data)
+	patterns := capturePatterns(data)
+	var ops []*renameOp
+	for _, m := range matches {
+		expanded, err := expandCommand([]string{template}, m.name, captureGroups(patterns, m.name))
+		if err != nil {
+			return nil, err
+		}
+		if expanded[0] == "" {
+			return nil, fmt.Errorf("rename template produced an empty name for %q", m.path)
+		}
+
+		op := &renameOp{oldPath: m.path, newPath: expanded[0]}
+		if !fullPathFlag.Get(data) {
+			op.newPath = filepath.Join(filepath.Dir(m.path), op.newPath)
+		} else if !filepath.IsAbs(op.newPath) {
+			op.newPath = filepath.Join(root, op.newPath)
+		}
+		if op.oldAbs, err = filepath.Abs(op.oldPath); err != nil {
+			return nil, fmt.Errorf("failed to get absolute path for %q: %v", op.oldPath, err)
+		}
+		if op.newAbs, err = filepath.Abs(op.newPath); err != nil {
+			return nil, fmt.Errorf("failed to get absolute path for %q: %v", op.newPath, err)
+		}
+		ops = append(ops, op)
+	}
+
+	targets := map[string]int{}
+	for _, op := range ops {
+		targets[op.newAbs]++
+	}
+	for _, op := range ops {
+		switch {
+		case op.unchanged():
+			op.note = "unchanged"
+		case targets[op.newAbs] > 1:
+			op.note, op.conflict = "collides with another rename", true
+		default:
+			// Existing files are never overwritten, even if they are also being
+			// renamed, so the order of the renames doesn't matter.
+			if _, err := os.Lstat(op.newAbs); err == nil {
+				op.note, op.conflict = "would overwrite an existing file", true
+			}
+		}
+	}
+	return ops, nil
+}
+
+// runRename shows the renames for the matches and performs them if the apply
+// flag is set. Nothing is renamed if any of the renames conflict.
+func (fp *filename) runRename(output command.Output, data *command.Data, root string, matches []*fileMatch) error {
+	ops, err := renameOps(data, root, matches)
+	if err != nil {
+		return output.Stderrln(err)
+	}
+
+	var oldWidth, conflicts int
+	var pending []*renameOp
+	for _, op := range ops {
+		oldWidth = max(oldWidth, len(op.oldPath))
+		if op.conflict {
+			conflicts++
+		} else if !op.unchanged() {
+			pending = append(pending, op)
+		}
+	}
+	for _, op := range ops {
+		output.Stdoutf("%-*s -> %s", oldWidth, op.oldPath, op.newPath)
+		if op.note != "" {
+			output.Stdoutf(" (%s)", op.note)
+		}
+		output.Stdoutln()
+	}
+
+	if conflicts > 0 {
+		return output.Stderrf("%d of %d renames conflict; no files were renamed\n", conflicts, len(ops))
+	}
+	if !applyFlag.Get(data) {
+		output.Stdoutf("%d files would be renamed (run again with --apply to rename them)\n", len(pending))
+		return nil
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	// Deeper paths are renamed first so renaming a directory doesn't move
+	// files that still need to be renamed.
+	depth := func(op *renameOp) int { return strings.Count(op.oldAbs, string(filepath.Separator)) }
+	sort.SliceStable(pending, func(i, j int) bool { return depth(pending[i]) > depth(pending[j]) })
+
+	// The journal is replaced as files are renamed so it is accurate even if
+	// a rename fails.
+	fp.LastRenames = nil
+	fp.changed = true
+	for _, op := range pending {
+		if err := osMkdirAll(filepath.Dir(op.newAbs), 0755); err != nil {
+			return output.Stderrf("failed to create directory for %q: %v (renamed %d of %d files; run `fp undo` to revert them)\n", op.newPath, err, len(fp.LastRenames), len(pending))
+		}
+		if err := osRename(op.oldAbs, op.newAbs); err != nil {
+			return output.Stderrf("failed to rename %q: %v (renamed %d of %d files; run `fp undo` to revert them)\n", op.oldPath, err, len(fp.LastRenames), len(pending))
+		}
+		fp.LastRenames = append(fp.LastRenames, &fileRename{Old: op.oldAbs, New: op.newAbs})
+	}
+	output.Stdoutf("Renamed %d files (run `fp undo` to revert them)\n", len(pending))
+	return nil
+}
+
+// undoRenames reverts the renames from the last `fp --rename --apply` (in
+// reverse order). Renames that were reverted are removed from the journal, so
+// it can be run again if a revert fails.
+func (fp *filename) undoRenames(output command.Output, data *command.Data) error {
+	if len(fp.LastRenames) == 0 {
+		return output.Stderrln("there are no renames to undo")
+	}
+
+	var reverted int
+	for len(fp.LastRenames) > 0 {
+		r := fp.LastRenames[len(fp.LastRenames)-1]
+		if _, err := os.Lstat(r.Old); err == nil {
+			return output.Stderrf("failed to undo rename of %q: %q already exists (reverted %d files)\n", r.New, r.Old, reverted)
+		}
+		if err := osRename(r.New, r.Old); err != nil {
+			return output.Stderrf("failed to undo rename of %q: %v (reverted %d files)\n", r.New, err, reverted)
+		}
+		fp.LastRenames = fp.LastRenames[:len(fp.LastRenames)-1]
+		fp.changed = true
+		reverted++
+	}
+	fp.LastRenames = nil
+	output.Stdoutf("Reverted %d renames\n", reverted)
+	return nil
+}
@@ -24,6 +24,7 @@ var (
 	invertFlag        = commander.ListFlag[string]("invert", 'v', "Pattern(s) required to be absent in each line", 0, command.UnboundedList, commander.ListifyValidatorOption(commander.IsRegex()))
 	matchOnlyFlag     = commander.BoolFlag("match-only", 'o', "Only show the matching segment")
 	colorFlag         = commander.BoolFlag("color", 'C', "Force (or unforce) the grep output to include color")
+	quietFlag         = commander.BoolFlag("quiet", 'q', "Don't print anything and stop at the first match")
 
 	matchColor = color.MultiFormat(color.Green, color.Bold)
 )
@@ -235,7 +236,7 @@ func applyNoUnique(f filter, s string, data *command.Data) ([]string, bool) {
 
 type inputSource interface {
 	Name() string
-	Process(command.Output, *command.Data, filter, *sliceSet) error
+	Process(command.Output, *command.Data, filter, *sliceSet, *searchResult) error
 	Flags() []commander.FlagInterface
 	MakeNode(command.Node) command.Node
 	Setup() []string
@@ -244,6 +245,78 @@ type inputSource interface {
 
 type Grep struct {
 	InputSource inputSource
+
+	// executed and matched are used to determine the exit code.
+	executed bool
+	matched  bool
+}
+
+// Exit codes that mirror the ones used by grep.
+const (
+	exitMatch   = 0
+	exitNoMatch = 1
+	exitError   = 2
+)
+
+// ExitCode converts the code returned by sourcerer.Source into a
+// grep-compatible exit code: 0 if anything matched, 1 if nothing
+// matched, and 2 if an error occurred. If none of the provided CLIs
+// ran a search (e.g. when generating the source file), then the code
+// is returned as is.
+func ExitCode(code int, gs ...*Grep) int {
+	if code != 0 {
+		return exitError
+	}
+	for _, g := range gs {
+		if !g.executed {
+			continue
+		}
+		if g.matched {
+			return exitMatch
+		}
+		return exitNoMatch
+	}
+	return code
+}
+
+// searchResult records whether anything matched the search (which
+// determines the exit code). Input sources set matched when a file or line
+// passes the filters, regardless of what (if anything) is written.
+type searchResult struct {
+	matched bool
+}
+
+// quietOutput is an output that discards everything written to stdout if
+// quiet is set.
+type quietOutput struct {
+	command.Output
+	quiet bool
+}
+
+func (qo *quietOutput) Stdout(s string) {
+	if !qo.quiet {
+		qo.Output.Stdout(s)
+	}
+}
+
+func (qo *quietOutput) Stdoutf(s string, a ...interface{}) {
+	qo.Stdout(fmt.Sprintf(s, a...))
+}
+
+func (qo *quietOutput) Stdoutln(a ...interface{}) {
+	qo.Stdout(fmt.Sprintln(a...))
+}
+
+func (qo *quietOutput) Color(fs ...color.Format) {
+	if !qo.quiet {
+		qo.Output.Color(fs...)
+	}
+}
+
+// stopAfterMatch returns whether or not the search should stop after the
+// first match.
+func stopAfterMatch(data *command.Data) bool {
+	return quietFlag.Get(data)
 }
 
 func (g *Grep) Changed() bool {
@@ -298,13 +371,33 @@ func colorMatch(r *regexp.Regexp) filter {
 	return &colorMatcher{r}
 }
 
+// patternRegex returns the regex string for the provided pattern after
+// applying the case and whole word flags.
+func patternRegex(pattern string, data *command.Data) string {
+	if !caseFlag.Get(data) {
+		pattern = fmt.Sprintf("(?i)%s", pattern)
+	}
+	if wholeWordFlag.Get(data) {
+		pattern = fmt.Sprintf("\\b%s\\b", pattern)
+	}
+	return pattern
+}
+
+// patternFilterer is an optional interface for input sources that can
+// convert a pattern into a custom filter (rather than a regex that is
+// matched against the entire line).
+type patternFilterer interface {
+	// patternFilter returns the filter for the pattern, or nil if the
+	// pattern should be treated as a regular pattern.
+	patternFilter(pattern string, data *command.Data) (filter, error)
+}
+
 func (g *Grep) Complete(*command.Input, *command.Data) (*command.Completion, error) {
 	return nil, nil
 }
 
 func (g *Grep) Execute(output command.Output, data *command.Data) error {
-	ignoreCase := !caseFlag.Get(data)
-	wholeWord := wholeWordFlag.Get(data)
+	pf, _ := g.InputSource.(patternFilterer)
 
 	var filters []filter
 	ps := data.Values[patternArgName]
@@ -313,14 +406,18 @@ func (g *Grep) Execute(output command.Output, data *command.Data) error {
 		for _, patternGroup := range command.GetData[[][]string](data, patternArgName) {
 			af := &andFilter{}
 			for _, pattern := range patternGroup {
-				if ignoreCase {
-					pattern = fmt.Sprintf("(?i)%s", pattern)
-				}
-				if wholeWord {
-					pattern = fmt.Sprintf("\\b%s\\b", pattern)
+				if pf != nil {
+					f, err := pf.patternFilter(pattern, data)
+					if err != nil {
+						return output.Err(err)
+					}
+					if f != nil {
+						af.filters = append(af.filters, f)
+						continue
+					}
 				}
 				// ListIsRegex ensures that only valid regexes reach this point.
-				af.filters = append(af.filters, colorMatch(regexp.MustCompile(pattern)))
+				af.filters = append(af.filters, colorMatch(regexp.MustCompile(patternRegex(pattern, data))))
 			}
 			of.filters = append(of.filters, af)
 		}
@@ -335,7 +432,11 @@ func (g *Grep) Execute(output command.Output, data *command.Data) error {
 		filters = append(filters, &invertMatcher{r})
 	}
 
-	return g.InputSource.Process(output, data, &andFilter{filters}, &sliceSet{map[string][][]string{}})
+	res := &searchResult{}
+	err := g.InputSource.Process(&quietOutput{Output: output, quiet: quietFlag.Get(data)}, data, &andFilter{filters}, &sliceSet{map[string][][]string{}}, res)
+	g.executed = true
+	g.matched = res.matched
+	return err
 }
 
 func (g *Grep) Node() command.Node {
@@ -344,6 +445,7 @@ func (g *Grep) Node() command.Node {
 		colorFlag,
 		invertFlag,
 		matchOnlyFlag,
+		quietFlag,
 		uniqueFlag,
 		wholeWordFlag,
 	)
@@ -0,0 +1,175 @@
+package grep
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+func TestExitCode(t *testing.T) {
+	commandtest.StubValue(t, &defaultColorValue, false)
+	// fp and rp tests search a directory with an empty file, a file with a
+	// line, and a broken symlink (which rp skips).
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "empty.txt"), nil, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "lines.txt"), []byte("alpha\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	broken := filepath.Join(dir, "broken")
+	if err := os.Symlink(filepath.Join(dir, "nowhere"), broken); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	_, brokenErr := os.Stat(broken)
+	commandtest.StubValue(t, &startDir, dir)
+	commandtest.StubValue(t, &runCommand, func([]string) ([]byte, []byte, error) { return nil, nil, nil })
+
+	for _, test := range []struct {
+		name string
+		// cli, if set, is used instead of ip (with input).
+		cli        func() *Grep
+		input      []string
+		args       []string
+		code       int
+		skipExec   bool
+		wantStdout string
+		wantStderr string
+		want       int
+	}{
+		{
+			name:  "returns 0 if a line matched",
+			input: []string{"alpha", "bravo"},
+			args:  []string{"^b", "-q"},
+			want:  0,
+		},
+		{
+			name:  "returns 1 if no line matched",
+			input: []string{"alpha", "bravo"},
+			args:  []string{"^c", "-q"},
+			want:  1,
+		},
+		{
+			name: "returns 1 if no input",
+			args: []string{"-q"},
+			want: 1,
+		},
+		{
+			name:       "returns 1 if count is zero",
+			input:      []string{"alpha", "bravo"},
+			args:       []string{"^c", "-c"},
+			wantStdout: "0\n",
+			want:       1,
+		},
+		{
+			name:       "returns 0 if count is non-zero",
+			input:      []string{"alpha", "bravo"},
+			args:       []string{"^b", "-c"},
+			wantStdout: "1\n",
+			want:       0,
+		},
+		{
+			name:       "returns 1 if no line matched with passthru",
+			input:      []string{"alpha", "bravo"},
+			args:       []string{"^c", "--passthru"},
+			wantStdout: "alpha\nbravo\n",
+			want:       1,
+		},
+		{
+			name:       "returns 0 if a line matched with passthru",
+			input:      []string{"alpha", "bravo"},
+			args:       []string{"^a", "--passthru"},
+			wantStdout: "alpha\nbravo\n",
+			want:       0,
+		},
+		{
+			name:       "returns 1 if no line matched with passthru and line buffering",
+			input:      []string{"alpha", "bravo"},
+			args:       []string{"zzz", "--passthru", "--line-buffered"},
+			wantStdout: "alpha\nbravo\n",
+			want:       1,
+		},
+		{
+			name:       "returns 0 if a line matched with passthru and line buffering",
+			input:      []string{"alpha", "bravo"},
+			args:       []string{"^b", "--passthru", "--line-buffered"},
+			wantStdout: "alpha\nbravo\n",
+			want:       0,
+		},
+		{
+			name:       "returns 0 if a file matched and cat printed nothing",
+			cli:        FilenameCLI,
+			args:       []string{"empty", "--cat"},
+			wantStdout: "\n",
+			want:       0,
+		},
+		{
+			name: "returns 0 if a file matched and exec printed nothing",
+			cli:  FilenameCLI,
+			args: []string{"empty", "--exec", "true {}"},
+			want: 0,
+		},
+		{
+			name: "returns 1 if no file matched",
+			cli:  FilenameCLI,
+			args: []string{"full", "--exec", "true {}"},
+			want: 1,
+		},
+		{
+			name:       "returns 0 if a line matched and paths were skipped",
+			cli:        RecursiveCLI,
+			args:       []string{"^alpha", "-n"},
+			wantStdout: filepath.Join(dir, "lines.txt") + ":alpha\n",
+			wantStderr: fmt.Sprintf("warning: skipped 1 path:\n  failed to resolve symlink %q: %v\n", broken, brokenErr),
+			want:       0,
+		},
+		{
+			name:  "returns 2 on error",
+			input: []string{"alpha", "bravo"},
+			args:  []string{"^b", "-q"},
+			code:  1,
+			want:  2,
+		},
+		{
+			name:     "returns code if nothing was searched",
+			skipExec: true,
+			want:     0,
+		},
+		{
+			name:     "returns 2 if error and nothing was searched",
+			skipExec: true,
+			code:     1,
+			want:     2,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stubWalkSettings(t, &walkSettings{})
+			g := &Grep{
+				InputSource: &stdin{
+					scanner: bufio.NewScanner(strings.NewReader(strings.Join(test.input, "\n"))),
+				},
+			}
+			if test.cli != nil {
+				g = test.cli()
+			}
+			if !test.skipExec {
+				commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+					Node:          g.Node(),
+					Args:          test.args,
+					WantStdout:    test.wantStdout,
+					WantStderr:    test.wantStderr,
+					SkipDataCheck: true,
+				})
+			}
+			if got := ExitCode(test.code, g); got != test.want {
+				t.Errorf("ExitCode(%d) returned %d; want %d", test.code, got, test.want)
+			}
+		})
+	}
+}
@@ -2,50 +2,292 @@ package grep
 
 import (
 	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
+	"golang.org/x/exp/slices"
+
+	"github.com/leep-frog/command/color"
 	"github.com/leep-frog/command/command"
 	"github.com/leep-frog/command/commander"
 )
 
+var (
+	recentFlag = commander.BoolFlag("recent", 'r', "List the newest matches first. If multiple sources are searched, then every entry must have a timestamp (so entries can be ordered across sources)")
+
+	resultArg       = commander.Arg[int]("N", "The number of the result (from the last search) to use", commander.Positive[int]())
+	printResultFlag = commander.BoolFlag("print", 'p', "Print the command (e.g. for eval or copying) instead of running it")
+	yesFlag         = commander.BoolFlag("yes", 'y', "Run destructive commands without asking for confirmation")
+
+	timestampColor    = color.Blue
+	resultNumberColor = color.Magenta
+
+	// destructiveRegexes match commands that require confirmation before
+	// they are re-run.
+	destructiveRegexes = []*regexp.Regexp{
+		regexp.MustCompile(`(^|[\s;&|(])(rm|rmdir|dd|shred|truncate|mkfs(\.\w+)?)(\s|$)`),
+		regexp.MustCompile(`\bgit\s+(push\s.*(\s-f\b|--force)|reset\s+--hard|clean\b)`),
+		regexp.MustCompile(`\bkubectl\s+delete\b`),
+		regexp.MustCompile(`(?i)\b(Remove-Item|drop\s+(table|database))\b`),
+	}
+)
+
+const (
+	historyTimeFormat = "2006-01-02 15:04:05"
+)
+
 func HistoryCLI() *Grep {
 	return &Grep{
 		InputSource: &history{},
 	}
 }
 
-type history struct{}
+type history struct {
+	// LastResults contains the commands from the most recent search (in the
+	// order they were printed), so they can be referenced with `hp x N`.
+	LastResults []string
+	changed     bool
+}
 
 func (*history) Name() string { return "hp" }
 func (*history) Setup() []string {
 	return []string{"history"}
 }
 
-func (*history) Flags() []commander.FlagInterface { return nil }
-func (*history) Changed() bool                    { return false }
+func (*history) Flags() []commander.FlagInterface {
+	return []commander.FlagInterface{
+		historySourceFlag,
+		sinceFlag,
+		untilFlag,
+		recentFlag,
+		rankFlag,
+		rankByFlag,
+		beforeFlag,
+		afterFlag,
+		groupSeparatorFlag,
+		lineNumbersFlag,
+	}
+}
+func (h *history) Changed() bool { return h.changed }
+
+func (h *history) MakeNode(n command.Node) command.Node {
+	return &commander.BranchNode{
+		Branches: map[string]command.Node{
+			"x": commander.SerialNodes(
+				commander.Description("Run (or print) the Nth result of the last search"),
+				commander.FlagProcessor(
+					printResultFlag,
+					yesFlag,
+				),
+				resultArg,
+				commander.ExecutableProcessor(h.runResult),
+			),
+		},
+		Default: n,
+	}
+}
+
+// runResult returns the Nth result of the last search so the shell runs it.
+func (h *history) runResult(output command.Output, data *command.Data) ([]string, error) {
+	n := resultArg.Get(data)
+	if n > len(h.LastResults) {
+		return nil, output.Stderrf("result %d does not exist (the last search had %d results)\n", n, len(h.LastResults))
+	}
+	cmd := h.LastResults[n-1]
+
+	if printResultFlag.Get(data) {
+		output.Stdoutln(cmd)
+		return nil, nil
+	}
+
+	if isDestructive(cmd) && !yesFlag.Get(data) {
+		output.Stdoutf("%s\nThis command looks destructive. Run it anyway? [y/N] ", cmd)
+		if !confirm() {
+			output.Stdoutln()
+			return nil, output.Stderrln("Not running command")
+		}
+	}
+	return []string{cmd}, nil
+}
+
+// isDestructive returns whether or not the command looks like it deletes or
+// overwrites things.
+func isDestructive(cmd string) bool {
+	for _, r := range destructiveRegexes {
+		if r.MatchString(cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+// confirm reads a line from stdin and returns whether or not it is a yes.
+func confirm() bool {
+	scanner := bufio.NewScanner(osStdin)
+	if !scanner.Scan() {
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	return answer == "y" || answer == "yes"
+}
 
-func (*history) MakeNode(n command.Node) command.Node {
-	return n
+// historyResult is a command that matched the search. If the results are
+// ranked, then it represents all entries of a unique command.
+type historyResult struct {
+	// command is the command without any history number prefix.
+	command         string
+	formattedString []string
+	// count is the number of entries for the command (only set when ranking).
+	count int
+	// number is the entry's number in its history source (not set when
+	// ranking).
+	number int
+	// newGroup indicates whether the result isn't adjacent to the previous
+	// one (only set when showing context).
+	newGroup bool
+	// last is the index of the command's most recent entry.
+	last int
+	// timestamp is the time of the command's most recent entry.
+	timestamp time.Time
+	frecency  float64
 }
 
-func (*history) Process(output command.Output, data *command.Data, f filter, ss *sliceSet) error {
-	s, err := osOpen(commander.SetupOutputFile(data))
+func (h *history) Process(output command.Output, data *command.Data, f filter, ss *sliceSet, res *searchResult) error {
+	entries, err := readHistory(output, data)
 	if err != nil {
-		return output.Stderrf("failed to open setup output file: %v\n", err)
+		return err
 	}
 
-	scanner := bufio.NewScanner(s)
-	scanner.Split(bufio.ScanLines)
-	for scanner.Scan() {
-		// We need to replace all null characters because (for windows)
-		// null characters creep into the history output file for some reason.
-		formattedString, ok := apply(f, strings.ReplaceAll(scanner.Text(), "\x00", ""), data, ss)
-		if !ok {
-			continue
+	// Entries without a timestamp are never in the time window.
+	if tw := newTimeWindow(data); tw != nil {
+		var inWindow []*historyEntry
+		for _, e := range entries {
+			if !e.timestamp.IsZero() && tw.contains(e.timestamp) {
+				inWindow = append(inWindow, e)
+			}
 		}
-		applyFormat(output, data, formattedString)
-		output.Stdoutln()
+		entries = inWindow
+	}
+
+	// Only include the timestamp column if there are timestamps.
+	var showTimestamps bool
+	for _, e := range entries {
+		if !e.timestamp.IsZero() {
+			showTimestamps = true
+			break
+		}
+	}
+
+	var results []*historyResult
+	if rankFlag.Get(data) {
+		if data.Int(beforeFlag.Name()) > 0 || data.Int(afterFlag.Name()) > 0 || lineNumbersFlag.Get(data) {
+			return output.Stderrln("--before, --after, and --line-numbers can't be used with --rank")
+		}
+
+		results = rankHistory(entries, f, data)
+	} else {
+		// Entries are in chronological order, so the most recent ones are last.
+		if recentFlag.Get(data) {
+			for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+				entries[i], entries[j] = entries[j], entries[i]
+			}
+		}
+
+		// The linked list provides context lines (and handles the unique flag).
+		list := newLinkedList(f, data, nil)
+		// Entries were already filtered by the time window.
+		list.window = nil
+		var i int
+		list.nextLine = func() (string, bool) {
+			if i >= len(entries) {
+				return "", false
+			}
+			e := entries[i]
+			i++
+			// The session history number is never matched (or shown), so
+			// --line-numbers only adds the entry number column.
+			return e.commandWithoutNumber(), true
+		}
+
+		var prevLine int
+		for formattedString, line, ok := list.getNext(ss); ok; formattedString, line, ok = list.getNext(ss) {
+			e := entries[line-1]
+			results = append(results, &historyResult{
+				command:         e.commandWithoutNumber(),
+				formattedString: formattedString,
+				timestamp:       e.timestamp,
+				number:          e.number,
+				newGroup:        prevLine > 0 && line > prevLine+1,
+			})
+			prevLine = line
+			if stopAfterMatch(data) {
+				break
+			}
+		}
+	}
+	if stopAfterMatch(data) && len(results) > 1 {
+		results = results[:1]
+	}
+	res.matched = len(results) > 0
+
+	var commands []string
+	for _, r := range results {
+		commands = append(commands, r.command)
+	}
+	if !slices.Equal(commands, h.LastResults) {
+		h.LastResults = commands
+		h.changed = true
 	}
 
+	writeResults(output, data, results, showTimestamps)
 	return nil
 }
+
+// writeResults writes the results, each prefixed by its number (and the time
+// of its most recent entry, if showTimestamps is set, its entry number, if
+// requested, and its count, if ranked).
+func writeResults(output command.Output, data *command.Data, results []*historyResult, showTimestamps bool) {
+	var maxCount, maxEntryNumber int
+	for _, r := range results {
+		maxCount = max(maxCount, r.count)
+		maxEntryNumber = max(maxEntryNumber, r.number)
+	}
+	numberWidth := len(strconv.Itoa(len(results)))
+	countWidth := len(strconv.Itoa(maxCount))
+	entryNumberWidth := len(strconv.Itoa(maxEntryNumber))
+
+	for i, r := range results {
+		if r.newGroup && groupSeparatorFlag.Get(data) {
+			output.Stdoutln("--")
+		}
+		applyFormatWithColor(output, data, resultNumberColor, []string{"", fmt.Sprintf("%*d", numberWidth, i+1)})
+		output.Stdout(" ")
+		if showTimestamps {
+			writeTimestamp(output, data, r.timestamp)
+		}
+		if lineNumbersFlag.Get(data) {
+			applyFormatWithColor(output, data, lineColor, []string{"", fmt.Sprintf("%*d", entryNumberWidth, r.number)})
+			output.Stdout(" ")
+		}
+		if r.count > 0 {
+			applyFormatWithColor(output, data, lineColor, []string{"", fmt.Sprintf("%*d", countWidth, r.count)})
+			output.Stdout(" ")
+		}
+		applyFormat(output, data, r.formattedString)
+		output.Stdoutln()
+	}
+}
+
+// writeTimestamp writes the timestamp column (which is blank if the timestamp
+// is unknown).
+func writeTimestamp(output command.Output, data *command.Data, t time.Time) {
+	if t.IsZero() {
+		output.Stdout(strings.Repeat(" ", len(historyTimeFormat)))
+	} else {
+		applyFormatWithColor(output, data, timestampColor, []string{"", t.Format(historyTimeFormat)})
+	}
+	output.Stdout(" ")
+}
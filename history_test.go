@@ -1,10 +1,15 @@
 package grep
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -18,11 +23,26 @@ func TestHistory(t *testing.T) {
 		commandtest.StubValue(t, &defaultColorValue, sc)
 		fakeColor := fakeColorFn(sc)
 		fakeInvertedColor := fakeColorFn(!sc)
+		withTime := func(sec int64, s string) string {
+			return fmt.Sprintf("%s %s", fakeColor(timestampColor, time.Unix(sec, 0).Format(historyTimeFormat)), s)
+		}
+		withNumber := func(n int, s string) string {
+			return fmt.Sprintf("%s %s", fakeColor(resultNumberColor, fmt.Sprint(n)), s)
+		}
+		withoutTime := func(s string) string {
+			return fmt.Sprintf("%s %s", strings.Repeat(" ", len(historyTimeFormat)), s)
+		}
 		for _, test := range []struct {
 			name      string
 			history   []string
 			osOpenErr error
-			etc       *commandtest.ExecuteTestCase
+			// historyFiles maps history sources to the contents of their file.
+			historyFiles map[string][]string
+			// lastResults are the results of the previous search.
+			lastResults []string
+			stdin       string
+			etc         *commandtest.ExecuteTestCase
+			want        *history
 		}{
 			{
 				name: "returns history",
@@ -33,12 +53,13 @@ func TestHistory(t *testing.T) {
 				},
 				etc: &commandtest.ExecuteTestCase{
 					WantStdout: strings.Join([]string{
-						"alpha",
-						"beta",
-						"delta",
+						withNumber(1, "alpha"),
+						withNumber(2, "beta"),
+						withNumber(3, "delta"),
 						"",
 					}, "\n"),
 				},
+				want: &history{LastResults: []string{"alpha", "beta", "delta"}},
 			},
 			{
 				name: "filters history",
@@ -53,11 +74,12 @@ func TestHistory(t *testing.T) {
 						patternArgName: [][]string{{"^.e"}},
 					}},
 					WantStdout: strings.Join([]string{
-						fmt.Sprintf("%s%s", fakeColor(matchColor, "be"), "ta"),
-						fmt.Sprintf("%s%s", fakeColor(matchColor, "de"), "lta"),
+						withNumber(1, fmt.Sprintf("%s%s", fakeColor(matchColor, "be"), "ta")),
+						withNumber(2, fmt.Sprintf("%s%s", fakeColor(matchColor, "de"), "lta")),
 						"",
 					}, "\n"),
 				},
+				want: &history{LastResults: []string{"beta", "delta"}},
 			},
 			{
 				name: "filters history with inverted coloring",
@@ -73,11 +95,12 @@ func TestHistory(t *testing.T) {
 						colorFlag.Name(): true,
 					}},
 					WantStdout: strings.Join([]string{
-						fmt.Sprintf("%s%s", fakeInvertedColor(matchColor, "be"), "ta"),
-						fmt.Sprintf("%s%s", fakeInvertedColor(matchColor, "de"), "lta"),
+						fmt.Sprintf("%s %s%s", fakeInvertedColor(resultNumberColor, "1"), fakeInvertedColor(matchColor, "be"), "ta"),
+						fmt.Sprintf("%s %s%s", fakeInvertedColor(resultNumberColor, "2"), fakeInvertedColor(matchColor, "de"), "lta"),
 						"",
 					}, "\n"),
 				},
+				want: &history{LastResults: []string{"beta", "delta"}},
 			},
 			{
 				name: "filters history considering case",
@@ -96,12 +119,13 @@ func TestHistory(t *testing.T) {
 						},
 					},
 					WantStdout: strings.Join([]string{
-						fakeColor(matchColor, "alphA"),
+						withNumber(1, fakeColor(matchColor, "alphA")),
 						// fakeColor(matchColor, "beta"),
-						fakeColor(matchColor, "deltA"),
+						withNumber(2, fakeColor(matchColor, "deltA")),
 						"",
 					}, "\n"),
 				},
+				want: &history{LastResults: []string{"alphA", "deltA"}},
 			},
 			{
 				name:      "errors on os.Open error",
@@ -127,11 +151,12 @@ func TestHistory(t *testing.T) {
 						},
 					},
 					WantStdout: strings.Join([]string{
-						"TfghjT",
-						"TxcvbnmT",
+						withNumber(1, "TfghjT"),
+						withNumber(2, "TxcvbnmT"),
 						"",
 					}, "\n"),
 				},
+				want: &history{LastResults: []string{"asdTfghjTkl", "TxcvbnmT"}},
 			},
 			{
 				name: "works with match only and overlapping matches",
@@ -149,11 +174,12 @@ func TestHistory(t *testing.T) {
 						},
 					},
 					WantStdout: strings.Join([]string{
-						"SdTfghSjT",
-						"TxScvbSnmT",
+						withNumber(1, "SdTfghSjT"),
+						withNumber(2, "TxScvbSnmT"),
 						"",
 					}, "\n"),
 				},
+				want: &history{LastResults: []string{"aSdTfghSjTkl", "TxScvbSnmT"}},
 			},
 			{
 				name: "works with match only and non-overlapping matches",
@@ -171,11 +197,12 @@ func TestHistory(t *testing.T) {
 						},
 					},
 					WantStdout: strings.Join([]string{
-						"SaS...TghjT",
-						"TzT...SnmS",
+						withNumber(1, "SaS...TghjT"),
+						withNumber(2, "TzT...SnmS"),
 						"",
 					}, "\n"),
 				},
+				want: &history{LastResults: []string{"SaSdfTghjTkl", "TzTxcvbSnmS"}},
 			},
 			{
 				name: "matches only whole word",
@@ -195,31 +222,673 @@ func TestHistory(t *testing.T) {
 						},
 					},
 					WantStdout: strings.Join([]string{
-						fmt.Sprintf("5 %s", fakeColor(matchColor, "alpha")),
+						withNumber(1, fakeColor(matchColor, "alpha")),
+						"",
+					}, "\n"),
+				},
+				want: &history{LastResults: []string{"alpha"}},
+			},
+			{
+				name: "searches history files",
+				historyFiles: map[string][]string{
+					bashSource: {
+						"echo bash one",
+						"ls",
+					},
+					fishSource: {
+						"- cmd: echo fish one\\nand two",
+						"  when: 1700000000",
+						"- cmd: pwd",
+						"  when: 1700000001",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"echo", "-s", "bash", "fish"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:           [][]string{{"echo"}},
+						historySourceFlag.Name(): []string{"bash", "fish"},
+					}},
+					WantStdout: strings.Join([]string{
+						withNumber(1, withoutTime(fmt.Sprintf("%s bash one", fakeColor(matchColor, "echo")))),
+						withNumber(2, withTime(1700000000, fmt.Sprintf("%s fish one\nand two", fakeColor(matchColor, "echo")))),
+						"",
+					}, "\n"),
+				},
+				want: &history{LastResults: []string{"echo bash one", "echo fish one\nand two"}},
+			},
+			{
+				name: "sorts entries from multiple history files by time",
+				historyFiles: map[string][]string{
+					zshSource: {
+						": 1700000000:0;echo zsh one",
+						": 1700000002:0;echo zsh two \\",
+						"and more",
+					},
+					fishSource: {
+						"- cmd: echo fish one",
+						"  when: 1700000001",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-s", "zsh", "fish"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						historySourceFlag.Name(): []string{"zsh", "fish"},
+					}},
+					WantStdout: strings.Join([]string{
+						withNumber(1, withTime(1700000000, "echo zsh one")),
+						withNumber(2, withTime(1700000001, "echo fish one")),
+						withNumber(3, withTime(1700000002, "echo zsh two \nand more")),
+						"",
+					}, "\n"),
+				},
+				want: &history{LastResults: []string{"echo zsh one", "echo fish one", "echo zsh two \nand more"}},
+			},
+			{
+				name: "filters history by time",
+				historyFiles: map[string][]string{
+					zshSource: {
+						": 1700000000:0;echo old",
+						": 1700600000:0;echo recent",
+						": 1700700000:0;ls",
+						"echo no timestamp",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"echo", "-s", "zsh", "--since", "2d"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:           [][]string{{"echo"}},
+						historySourceFlag.Name(): []string{"zsh"},
+						sinceFlag.Name():         "2d",
+					}},
+					WantStdout: strings.Join([]string{
+						withNumber(1, withTime(1700600000, fmt.Sprintf("%s recent", fakeColor(matchColor, "echo")))),
+						"",
+					}, "\n"),
+				},
+				want: &history{LastResults: []string{"echo recent"}},
+			},
+			{
+				name: "lists recent history first",
+				historyFiles: map[string][]string{
+					bashSource: {
+						"#1700000000",
+						"echo one",
+						"#1700000001",
+						"echo two",
+						"ls",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"echo", "-s", "bash", "-r"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:           [][]string{{"echo"}},
+						historySourceFlag.Name(): []string{"bash"},
+						recentFlag.Name():        true,
+					}},
+					WantStdout: strings.Join([]string{
+						withNumber(1, withTime(1700000001, fmt.Sprintf("%s two", fakeColor(matchColor, "echo")))),
+						withNumber(2, withTime(1700000000, fmt.Sprintf("%s one", fakeColor(matchColor, "echo")))),
+						"",
+					}, "\n"),
+				},
+				want: &history{LastResults: []string{"echo two", "echo one"}},
+			},
+			{
+				name: "lists recent history from multiple history files first",
+				historyFiles: map[string][]string{
+					zshSource: {
+						": 1700000000:0;echo zsh one",
+						": 1700000002:0;echo zsh two",
+					},
+					fishSource: {
+						"- cmd: echo fish one",
+						"  when: 1700000001",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-s", "zsh", "fish", "-r"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						historySourceFlag.Name(): []string{"zsh", "fish"},
+						recentFlag.Name():        true,
+					}},
+					WantStdout: strings.Join([]string{
+						withNumber(1, withTime(1700000002, "echo zsh two")),
+						withNumber(2, withTime(1700000001, "echo fish one")),
+						withNumber(3, withTime(1700000000, "echo zsh one")),
+						"",
+					}, "\n"),
+				},
+				want: &history{LastResults: []string{"echo zsh two", "echo fish one", "echo zsh one"}},
+			},
+			{
+				name: "errors on recent with multiple history files without timestamps",
+				historyFiles: map[string][]string{
+					bashSource: {
+						"echo bash one",
+					},
+					fishSource: {
+						"- cmd: echo fish one",
+						"  when: 1700000001",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-s", "bash", "fish", "-r"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						historySourceFlag.Name(): []string{"bash", "fish"},
+						recentFlag.Name():        true,
+					}},
+					WantStderr: "--recent can't be used with multiple sources unless every entry has a timestamp (bash history has entries without one)\n",
+					WantErr:    fmt.Errorf("--recent can't be used with multiple sources unless every entry has a timestamp (bash history has entries without one)"),
+				},
+			},
+			{
+				name: "lists recent history first without timestamps",
+				history: []string{
+					"alpha",
+					"beta",
+					"delta",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"a$", "-r", "-q"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:    [][]string{{"a$"}},
+						recentFlag.Name(): true,
+						quietFlag.Name():  true,
+					}},
+				},
+				want: &history{LastResults: []string{"delta"}},
+			},
+			{
+				name: "ranks commands by frequency",
+				history: []string{
+					"    1  git status",
+					"    2  ls",
+					"    3  git status",
+					"    4  git push",
+					"    5* git status",
+					"    6  ls",
+					"    7  echo",
+					"    8  ls",
+					"    9  ls",
+					"   10  git status",
+					"   11  ls",
+					"   12  ls",
+					"   13  ls",
+					"   14  ls",
+					"   15  ls",
+					"   16  ls",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^(git|ls)", "-R"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:  [][]string{{"^(git|ls)"}},
+						rankFlag.Name(): true,
+					}},
+					WantStdout: strings.Join([]string{
+						withNumber(1, fmt.Sprintf("%s %s", fakeColor(lineColor, "10"), fakeColor(matchColor, "ls"))),
+						withNumber(2, fmt.Sprintf("%s %s status", fakeColor(lineColor, " 4"), fakeColor(matchColor, "git"))),
+						withNumber(3, fmt.Sprintf("%s %s push", fakeColor(lineColor, " 1"), fakeColor(matchColor, "git"))),
+						"",
+					}, "\n"),
+				},
+				want: &history{LastResults: []string{"ls", "git status", "git push"}},
+			},
+			{
+				name: "ranks commands by recency",
+				history: []string{
+					"    1  git status",
+					"    2  ls",
+					"    3  git status",
+					"    4  git push",
+					"    5  ls",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-R", "--rank-by", "recency"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						rankFlag.Name():   true,
+						rankByFlag.Name(): "recency",
+					}},
+					WantStdout: strings.Join([]string{
+						withNumber(1, fmt.Sprintf("%s ls", fakeColor(lineColor, "2"))),
+						withNumber(2, fmt.Sprintf("%s git push", fakeColor(lineColor, "1"))),
+						withNumber(3, fmt.Sprintf("%s git status", fakeColor(lineColor, "2"))),
+						"",
+					}, "\n"),
+				},
+				want: &history{LastResults: []string{"ls", "git push", "git status"}},
+			},
+			{
+				name: "ranks commands by frecency",
+				historyFiles: map[string][]string{
+					zshSource: {
+						": 1690000000:0;make build",
+						": 1690000001:0;make build",
+						": 1690000002:0;make build",
+						": 1700699000:0;make test",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-s", "zsh", "-R", "--rank-by", "frecency"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						historySourceFlag.Name(): []string{"zsh"},
+						rankFlag.Name():          true,
+						rankByFlag.Name():        "frecency",
+					}},
+					WantStdout: strings.Join([]string{
+						withNumber(1, withTime(1700699000, fmt.Sprintf("%s make test", fakeColor(lineColor, "1")))),
+						withNumber(2, withTime(1690000002, fmt.Sprintf("%s make build", fakeColor(lineColor, "3")))),
 						"",
 					}, "\n"),
 				},
+				want: &history{LastResults: []string{"make test", "make build"}},
+			},
+			{
+				name: "errors on invalid rank order",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-R", "--rank-by", "alphabetical"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						rankFlag.Name():   true,
+						rankByFlag.Name(): "alphabetical",
+					}},
+					WantStderr: "validation for \"rank-by\" failed: [InList] argument must be one of [frequency recency frecency]\n",
+					WantErr:    fmt.Errorf("validation for \"rank-by\" failed: [InList] argument must be one of [frequency recency frecency]"),
+				},
+			},
+			{
+				name: "errors if history file doesn't exist",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-s", "pwsh"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						historySourceFlag.Name(): []string{"pwsh"},
+					}},
+					WantStderr: "failed to open pwsh history file: open HOME/.local/share/powershell/PSReadLine/ConsoleHost_history.txt: no such file or directory\n",
+					WantErr:    fmt.Errorf("failed to open pwsh history file: open HOME/.local/share/powershell/PSReadLine/ConsoleHost_history.txt: no such file or directory"),
+				},
+			},
+			{
+				name: "errors on invalid history source",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-s", "tcsh"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						historySourceFlag.Name(): []string{"tcsh"},
+					}},
+					WantStderr: "validation for \"source\" failed: [InList] argument must be one of [session bash zsh fish pwsh]\n",
+					WantErr:    fmt.Errorf("validation for \"source\" failed: [InList] argument must be one of [session bash zsh fish pwsh]"),
+				},
+			},
+			{
+				name: "pads result numbers",
+				history: []string{
+					"echo 1", "echo 2", "echo 3", "echo 4", "echo 5",
+					"echo 6", "echo 7", "echo 8", "echo 9", "echo 10",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					WantStdout: strings.Join([]string{
+						fmt.Sprintf("%s echo 1", fakeColor(resultNumberColor, " 1")),
+						fmt.Sprintf("%s echo 2", fakeColor(resultNumberColor, " 2")),
+						fmt.Sprintf("%s echo 3", fakeColor(resultNumberColor, " 3")),
+						fmt.Sprintf("%s echo 4", fakeColor(resultNumberColor, " 4")),
+						fmt.Sprintf("%s echo 5", fakeColor(resultNumberColor, " 5")),
+						fmt.Sprintf("%s echo 6", fakeColor(resultNumberColor, " 6")),
+						fmt.Sprintf("%s echo 7", fakeColor(resultNumberColor, " 7")),
+						fmt.Sprintf("%s echo 8", fakeColor(resultNumberColor, " 8")),
+						fmt.Sprintf("%s echo 9", fakeColor(resultNumberColor, " 9")),
+						fmt.Sprintf("%s echo 10", fakeColor(resultNumberColor, "10")),
+						"",
+					}, "\n"),
+				},
+				want: &history{LastResults: []string{"echo 1", "echo 2", "echo 3", "echo 4", "echo 5", "echo 6", "echo 7", "echo 8", "echo 9", "echo 10"}},
+			},
+			{
+				name:        "doesn't change if results are the same",
+				history:     []string{"alpha", "beta"},
+				lastResults: []string{"alpha"},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"al"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName: [][]string{{"al"}},
+					}},
+					WantStdout: withNumber(1, fmt.Sprintf("%spha\n", fakeColor(matchColor, "al"))),
+				},
+			},
+			{
+				name:        "clears results if nothing matches",
+				history:     []string{"alpha", "beta"},
+				lastResults: []string{"alpha"},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"gamma"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName: [][]string{{"gamma"}},
+					}},
+				},
+				want: &history{},
+			},
+			{
+				name: "shows context lines",
+				history: []string{
+					"git fetch",
+					"git rebase origin/main",
+					"git push -f",
+					"ls",
+					"make",
+					"go test",
+					"git rebase -i HEAD~2",
+					"git log",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"rebase", "-b", "1", "-a", "1"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:    [][]string{{"rebase"}},
+						beforeFlag.Name(): 1,
+						afterFlag.Name():  1,
+					}},
+					WantStdout: strings.Join([]string{
+						withNumber(1, "git fetch"),
+						withNumber(2, fmt.Sprintf("git %s origin/main", fakeColor(matchColor, "rebase"))),
+						withNumber(3, "git push -f"),
+						withNumber(4, "go test"),
+						withNumber(5, fmt.Sprintf("git %s -i HEAD~2", fakeColor(matchColor, "rebase"))),
+						withNumber(6, "git log"),
+						"",
+					}, "\n"),
+				},
+				want: &history{LastResults: []string{"git fetch", "git rebase origin/main", "git push -f", "go test", "git rebase -i HEAD~2", "git log"}},
+			},
+			{
+				name: "shows context lines with group separator",
+				history: []string{
+					"git fetch",
+					"git rebase origin/main",
+					"git push -f",
+					"ls",
+					"git rebase -i HEAD~2",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"rebase", "-b", "1", "-g"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:            [][]string{{"rebase"}},
+						beforeFlag.Name():         1,
+						groupSeparatorFlag.Name(): true,
+					}},
+					WantStdout: strings.Join([]string{
+						withNumber(1, "git fetch"),
+						withNumber(2, fmt.Sprintf("git %s origin/main", fakeColor(matchColor, "rebase"))),
+						"--",
+						withNumber(3, "ls"),
+						withNumber(4, fmt.Sprintf("git %s -i HEAD~2", fakeColor(matchColor, "rebase"))),
+						"",
+					}, "\n"),
+				},
+				want: &history{LastResults: []string{"git fetch", "git rebase origin/main", "ls", "git rebase -i HEAD~2"}},
+			},
+			{
+				name: "shows session history numbers",
+				history: []string{
+					"    8  git fetch",
+					"    9  git rebase origin/main",
+					"   10  git push -f",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^git", "-N"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:         [][]string{{"^git"}},
+						lineNumbersFlag.Name(): true,
+					}},
+					WantStdout: strings.Join([]string{
+						withNumber(1, fmt.Sprintf("%s %s fetch", fakeColor(lineColor, " 8"), fakeColor(matchColor, "git"))),
+						withNumber(2, fmt.Sprintf("%s %s rebase origin/main", fakeColor(lineColor, " 9"), fakeColor(matchColor, "git"))),
+						withNumber(3, fmt.Sprintf("%s %s push -f", fakeColor(lineColor, "10"), fakeColor(matchColor, "git"))),
+						"",
+					}, "\n"),
+				},
+				want: &history{LastResults: []string{"git fetch", "git rebase origin/main", "git push -f"}},
+			},
+			{
+				name: "matches session history without numbers",
+				history: []string{
+					"    8  git fetch",
+					"    9  ls",
+					"   10  git push -f",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^git"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName: [][]string{{"^git"}},
+					}},
+					WantStdout: strings.Join([]string{
+						withNumber(1, fmt.Sprintf("%s fetch", fakeColor(matchColor, "git"))),
+						withNumber(2, fmt.Sprintf("%s push -f", fakeColor(matchColor, "git"))),
+						"",
+					}, "\n"),
+				},
+				want: &history{LastResults: []string{"git fetch", "git push -f"}},
+			},
+			{
+				name: "shows history file entry numbers with context",
+				historyFiles: map[string][]string{
+					bashSource: {
+						"git fetch",
+						"git rebase origin/main",
+						"git push -f",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"rebase", "-s", "bash", "-N", "-a", "1"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						patternArgName:           [][]string{{"rebase"}},
+						historySourceFlag.Name(): []string{"bash"},
+						lineNumbersFlag.Name():   true,
+						afterFlag.Name():         1,
+					}},
+					WantStdout: strings.Join([]string{
+						withNumber(1, fmt.Sprintf("%s git %s origin/main", fakeColor(lineColor, "2"), fakeColor(matchColor, "rebase"))),
+						withNumber(2, fmt.Sprintf("%s git push -f", fakeColor(lineColor, "3"))),
+						"",
+					}, "\n"),
+				},
+				want: &history{LastResults: []string{"git rebase origin/main", "git push -f"}},
+			},
+			{
+				name: "errors if context is used with rank",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-R", "-b", "2"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						rankFlag.Name():   true,
+						beforeFlag.Name(): 2,
+					}},
+					WantStderr: "--before, --after, and --line-numbers can't be used with --rank\n",
+					WantErr:    fmt.Errorf("--before, --after, and --line-numbers can't be used with --rank"),
+				},
+			},
+			// hp x
+			{
+				name:        "runs result",
+				lastResults: []string{"echo one", "echo two"},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"x", "2"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						resultArg.Name(): 2,
+					}},
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{"echo two"},
+					},
+				},
+			},
+			{
+				name:        "prints result",
+				lastResults: []string{"echo one", "echo two"},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"x", "1", "-p"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						resultArg.Name():       1,
+						printResultFlag.Name(): true,
+					}},
+					WantStdout: "echo one\n",
+				},
+			},
+			{
+				name:        "prints destructive result without confirmation",
+				lastResults: []string{"rm -rf build"},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"x", "1", "-p"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						resultArg.Name():       1,
+						printResultFlag.Name(): true,
+					}},
+					WantStdout: "rm -rf build\n",
+				},
+			},
+			{
+				name:        "runs destructive result if confirmed",
+				lastResults: []string{"ls", "git push --force origin main"},
+				stdin:       "y\n",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"x", "2"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						resultArg.Name(): 2,
+					}},
+					WantStdout: "git push --force origin main\nThis command looks destructive. Run it anyway? [y/N] ",
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{"git push --force origin main"},
+					},
+				},
+			},
+			{
+				name:        "doesn't run destructive result if not confirmed",
+				lastResults: []string{"cd build && rm *.o"},
+				stdin:       "n\n",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"x", "1"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						resultArg.Name(): 1,
+					}},
+					WantStdout: "cd build && rm *.o\nThis command looks destructive. Run it anyway? [y/N] \n",
+					WantStderr: "Not running command\n",
+					WantErr:    fmt.Errorf("Not running command"),
+				},
+			},
+			{
+				name:        "runs destructive result with yes flag",
+				lastResults: []string{"kubectl delete pod web"},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"x", "1", "-y"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						resultArg.Name(): 1,
+						yesFlag.Name():   true,
+					}},
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{"kubectl delete pod web"},
+					},
+				},
+			},
+			{
+				name:        "errors if result doesn't exist",
+				lastResults: []string{"echo one"},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"x", "2"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						resultArg.Name(): 2,
+					}},
+					WantStderr: "result 2 does not exist (the last search had 1 results)\n",
+					WantErr:    fmt.Errorf("result 2 does not exist (the last search had 1 results)"),
+				},
+			},
+			{
+				name: "errors if result number isn't positive",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"x", "0"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						resultArg.Name(): 0,
+					}},
+					WantStderr: "validation for \"N\" failed: [Positive] value isn't positive\n",
+					WantErr:    fmt.Errorf("validation for \"N\" failed: [Positive] value isn't positive"),
+				},
 			},
 			/* Useful for commenting out tests. */
 		} {
 			t.Run(testName(sc, test.name), func(t *testing.T) {
-				// Stub os.Open if necessary
+				// Stub os.Open to return an error, or to keep track of opened files
+				// (so we can check that they're closed).
+				var opened []*closeTracker
 				if test.osOpenErr != nil {
 					commandtest.StubValue(t, &osOpen, func(s string) (io.Reader, error) { return nil, test.osOpenErr })
+				} else {
+					commandtest.StubValue(t, &osOpen, func(s string) (io.Reader, error) {
+						f, err := os.Open(s)
+						if err != nil {
+							return nil, err
+						}
+						ct := &closeTracker{ReadCloser: f, name: s}
+						opened = append(opened, ct)
+						return ct, nil
+					})
+				}
+
+				// Stub the home directory and write any history files.
+				home := t.TempDir()
+				commandtest.StubValue(t, &osUserHomeDir, func() (string, error) { return home, nil })
+				commandtest.StubValue(t, &osGetenv, func(string) string { return "" })
+				commandtest.StubValue(t, &timeNow, func() time.Time { return time.Unix(1700700000, 0) })
+				for source, contents := range test.historyFiles {
+					f, err := historyFile(source)
+					if err != nil {
+						t.Fatalf("historyFile(%q) returned error: %v", source, err)
+					}
+					if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+						t.Fatalf("failed to create history directory: %v", err)
+					}
+					if err := os.WriteFile(f, []byte(strings.Join(contents, "\n")), 0644); err != nil {
+						t.Fatalf("failed to write history file: %v", err)
+					}
+				}
+				test.etc.WantStderr = strings.ReplaceAll(test.etc.WantStderr, "HOME", home)
+				if test.etc.WantErr != nil {
+					test.etc.WantErr = errors.New(strings.ReplaceAll(test.etc.WantErr.Error(), "HOME", home))
+				}
+
+				if test.stdin != "" {
+					commandtest.StubValue(t, &osStdin, io.Reader(strings.NewReader(test.stdin)))
 				}
 
 				// Run test
-				h := HistoryCLI()
+				h := &Grep{
+					InputSource: &history{
+						LastResults: test.lastResults,
+					},
+				}
+				var g *Grep
+				if test.want != nil {
+					g = &Grep{
+						InputSource: test.want,
+					}
+				}
 				test.etc.Node = h.Node()
 				test.etc.RequiresSetup = true
 				test.etc.SetupContents = test.history
 				commandertest.ExecuteTest(t, test.etc)
-				commandertest.ChangeTest(t, nil, h)
+				commandertest.ChangeTest(t, g, h, cmpopts.IgnoreUnexported(history{}, Grep{}))
+				for _, ct := range opened {
+					if !ct.closed {
+						t.Errorf("hp didn't close %q", ct.name)
+					}
+				}
 			})
 		}
 	}
 }
 
+// closeTracker is a file that records whether it was closed.
+type closeTracker struct {
+	io.ReadCloser
+	name   string
+	closed bool
+}
+
+func (ct *closeTracker) Close() error {
+	ct.closed = true
+	return ct.ReadCloser.Close()
+}
+
 func TestHistoryMetadata(t *testing.T) {
 	c := HistoryCLI()
 
@@ -233,6 +902,76 @@ func TestHistoryMetadata(t *testing.T) {
 	}
 }
 
+func TestParseHistory(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		parser func(*bufio.Scanner) []*historyEntry
+		lines  []string
+		want   []*historyEntry
+	}{
+		{
+			name:   "parses session history",
+			parser: parseSessionHistory,
+			lines:  []string{"  1  echo\x00 one", "  2  ls"},
+			want: []*historyEntry{
+				{command: "  1  echo one", number: 1},
+				{command: "  2  ls", number: 2},
+			},
+		},
+		{
+			name:   "parses bash history with timestamps",
+			parser: parseBashHistory,
+			lines:  []string{"echo one", "#1700000000", "echo two", "#not-a-timestamp"},
+			want: []*historyEntry{
+				{command: "echo one"},
+				{command: "echo two", timestamp: time.Unix(1700000000, 0)},
+				{command: "#not-a-timestamp"},
+			},
+		},
+		{
+			name:   "parses zsh history",
+			parser: parseZshHistory,
+			lines:  []string{"echo simple", ": 1700000000:3;for x in 1 2; do \\", "  echo $x \\", "done", ": 1700000005:0;echo \xc5\x83\xa4"},
+			want: []*historyEntry{
+				{command: "echo simple"},
+				{command: "for x in 1 2; do \n  echo $x \ndone", timestamp: time.Unix(1700000000, 0)},
+				{command: "echo \u0144", timestamp: time.Unix(1700000005, 0)},
+			},
+		},
+		{
+			name:   "parses fish history",
+			parser: parseFishHistory,
+			lines: []string{
+				"- cmd: echo one\\ntwo \\\\n",
+				"  when: 1700000000",
+				"  paths:",
+				"    - some/path",
+				"- cmd: ls",
+			},
+			want: []*historyEntry{
+				{command: "echo one\ntwo \\n", timestamp: time.Unix(1700000000, 0)},
+				{command: "ls"},
+			},
+		},
+		{
+			name:   "parses PowerShell history",
+			parser: parsePwshHistory,
+			lines:  []string{"Get-ChildItem", "foreach ($x in 1..2) {`", "  echo $x`", "}"},
+			want: []*historyEntry{
+				{command: "Get-ChildItem"},
+				{command: "foreach ($x in 1..2) {\n  echo $x\n}"},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			scanner := bufio.NewScanner(strings.NewReader(strings.Join(test.lines, "\n")))
+			if diff := cmp.Diff(test.want, test.parser(scanner), cmp.AllowUnexported(historyEntry{})); diff != "" {
+				t.Errorf("parser(%v) returned diff (-want, +got):\n%s", test.lines, diff)
+			}
+		})
+	}
+}
+
 func TestDisjointMatches(t *testing.T) {
 	for _, test := range []struct {
 		name    string
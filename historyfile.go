@@ -0,0 +1,314 @@
+package grep
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+const (
+	sessionSource = "session"
+	bashSource    = "bash"
+	zshSource     = "zsh"
+	fishSource    = "fish"
+	pwshSource    = "pwsh"
+)
+
+var (
+	osGetenv      = os.Getenv
+	osUserHomeDir = os.UserHomeDir
+
+	historySources    = []string{sessionSource, bashSource, zshSource, fishSource, pwshSource}
+	historySourceFlag = commander.ListFlag[string]("source", 's', "The history source(s) to search. `session` (the default) is the output of the `history` command. The others are read directly from the shell's history file. Shells usually don't export HISTFILE, so (unless it's exported) the bash history file is ~/.bash_history", 1, command.UnboundedList, commander.ListifyValidatorOption(commander.InList(historySources...)), commander.SimpleDistinctCompleter[[]string](historySources...))
+
+	historyParsers = map[string]func(*bufio.Scanner) []*historyEntry{
+		sessionSource: parseSessionHistory,
+		bashSource:    parseBashHistory,
+		zshSource:     parseZshHistory,
+		fishSource:    parseFishHistory,
+		pwshSource:    parsePwshHistory,
+	}
+
+	// bashTimestampRegex matches the timestamp comments that bash writes
+	// before each command when HISTTIMEFORMAT is set.
+	bashTimestampRegex = regexp.MustCompile(`^#(\d+)$`)
+	// zshExtendedRegex matches a line in zsh's extended history format
+	// (`: <start time>:<elapsed seconds>;<command>`).
+	zshExtendedRegex = regexp.MustCompile(`^: *(\d+):\d+;(.*)$`)
+	// historyNumberRegex matches the history number (and modified marker)
+	// that the `history` command prints before each command.
+	historyNumberRegex = regexp.MustCompile(`^\s*(\d+)\*?\s+`)
+)
+
+// historyEntry is a single command from a history source.
+type historyEntry struct {
+	command string
+	// source is the history source that the entry came from.
+	source string
+	// timestamp is when the command was run (or zero if unknown).
+	timestamp time.Time
+	// number is the entry's history number (for the session source) or its
+	// position in its history file.
+	number int
+}
+
+// commandWithoutNumber returns the command without the history number that
+// the `history` command prints before it.
+func (e *historyEntry) commandWithoutNumber() string {
+	if e.source != sessionSource {
+		return e.command
+	}
+	return historyNumberRegex.ReplaceAllString(e.command, "")
+}
+
+// historyFile returns the path of the history file for the provided source.
+func historyFile(source string) (string, error) {
+	home, err := osUserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dataDir := osGetenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+
+	switch source {
+	case bashSource:
+		if f := osGetenv("HISTFILE"); f != "" {
+			return f, nil
+		}
+		return filepath.Join(home, ".bash_history"), nil
+	case zshSource:
+		if dir := osGetenv("ZDOTDIR"); dir != "" {
+			return filepath.Join(dir, ".zsh_history"), nil
+		}
+		return filepath.Join(home, ".zsh_history"), nil
+	case fishSource:
+		return filepath.Join(dataDir, "fish", "fish_history"), nil
+	case pwshSource:
+		// APPDATA is only set on Windows.
+		if appData := osGetenv("APPDATA"); appData != "" {
+			return filepath.Join(appData, "Microsoft", "Windows", "PowerShell", "PSReadLine", "ConsoleHost_history.txt"), nil
+		}
+		return filepath.Join(dataDir, "powershell", "PSReadLine", "ConsoleHost_history.txt"), nil
+	}
+	return "", fmt.Errorf("unknown history source %q", source)
+}
+
+// readHistory returns the entries from all of the provided history sources.
+// If multiple sources are provided and every entry has a timestamp, then
+// entries are sorted by time. Otherwise, entries are in source order (which
+// isn't chronological, so the recent flag can't be used).
+func readHistory(output command.Output, data *command.Data) ([]*historyEntry, error) {
+	sources := historySourceFlag.Get(data)
+	if len(sources) == 0 {
+		sources = []string{sessionSource}
+	}
+
+	var entries []*historyEntry
+	for _, source := range sources {
+		es, err := readHistorySource(output, data, source)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, es...)
+	}
+
+	if len(sources) > 1 {
+		for _, e := range entries {
+			if !e.timestamp.IsZero() {
+				continue
+			}
+			if recentFlag.Get(data) {
+				return nil, output.Stderrf("--%s can't be used with multiple sources unless every entry has a timestamp (%s history has entries without one)\n", recentFlag.Name(), e.source)
+			}
+			return entries, nil
+		}
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].timestamp.Before(entries[j].timestamp)
+		})
+	}
+	return entries, nil
+}
+
+// readHistorySource returns the entries from the provided history source.
+func readHistorySource(output command.Output, data *command.Data, source string) ([]*historyEntry, error) {
+	var r io.Reader
+	if source == sessionSource {
+		var err error
+		if r, err = osOpen(commander.SetupOutputFile(data)); err != nil {
+			return nil, output.Stderrf("failed to open setup output file: %v\n", err)
+		}
+	} else {
+		f, err := historyFile(source)
+		if err != nil {
+			return nil, output.Stderrf("failed to get %s history file: %v\n", source, err)
+		}
+		if r, err = osOpen(f); err != nil {
+			return nil, output.Stderrf("failed to open %s history file: %v\n", source, err)
+		}
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	scanner := bufio.NewScanner(r)
+	entries := historyParsers[source](scanner)
+	for i, e := range entries {
+		e.source = source
+		if e.number == 0 {
+			e.number = i + 1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, output.Stderrf("failed to read %s history: %v\n", source, err)
+	}
+	return entries, nil
+}
+
+// parseSessionHistory parses the output of the `history` command.
+func parseSessionHistory(scanner *bufio.Scanner) []*historyEntry {
+	var entries []*historyEntry
+	for scanner.Scan() {
+		// We need to replace all null characters because (for windows)
+		// null characters creep into the history output file for some reason.
+		e := &historyEntry{command: strings.ReplaceAll(scanner.Text(), "\x00", "")}
+		if m := historyNumberRegex.FindStringSubmatch(e.command); m != nil {
+			e.number, _ = strconv.Atoi(m[1])
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// parseBashHistory parses a bash history file. If HISTTIMEFORMAT is set, then
+// bash writes a `#<timestamp>` comment before each command.
+func parseBashHistory(scanner *bufio.Scanner) []*historyEntry {
+	var entries []*historyEntry
+	var timestamp time.Time
+	for scanner.Scan() {
+		s := scanner.Text()
+		if m := bashTimestampRegex.FindStringSubmatch(s); m != nil {
+			if sec, err := strconv.ParseInt(m[1], 10, 64); err == nil {
+				timestamp = time.Unix(sec, 0)
+				continue
+			}
+		}
+		entries = append(entries, &historyEntry{command: s, timestamp: timestamp})
+		timestamp = time.Time{}
+	}
+	return entries
+}
+
+// parseZshHistory parses a zsh history file in either the simple or extended
+// format. Multi-line commands are stored with a backslash at the end of each
+// line but the last.
+func parseZshHistory(scanner *bufio.Scanner) []*historyEntry {
+	var entries []*historyEntry
+	for scanner.Scan() {
+		s := unmetafy(scanner.Text())
+		e := &historyEntry{command: s}
+		if m := zshExtendedRegex.FindStringSubmatch(s); m != nil {
+			if sec, err := strconv.ParseInt(m[1], 10, 64); err == nil {
+				e.command = m[2]
+				e.timestamp = time.Unix(sec, 0)
+			}
+		}
+
+		for strings.HasSuffix(e.command, "\\") && scanner.Scan() {
+			e.command = e.command[:len(e.command)-1] + "\n" + unmetafy(scanner.Text())
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// unmetafy decodes zsh's "metafied" encoding, in which certain bytes
+// (including many non-ASCII bytes) are written as 0x83 followed by the byte
+// XOR'd with 0x20.
+func unmetafy(s string) string {
+	if !strings.Contains(s, "\x83") {
+		return s
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0x83 && i+1 < len(s) {
+			i++
+			b = append(b, s[i]^0x20)
+			continue
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
+
+// parseFishHistory parses fish's (YAML-like) history file, in which each
+// entry starts with a `- cmd: <command>` line, followed by an indented
+// `when: <timestamp>` line (and optionally a list of paths).
+func parseFishHistory(scanner *bufio.Scanner) []*historyEntry {
+	var entries []*historyEntry
+	for scanner.Scan() {
+		s := scanner.Text()
+		if cmd, ok := strings.CutPrefix(s, "- cmd: "); ok {
+			entries = append(entries, &historyEntry{command: unescapeFish(cmd)})
+			continue
+		}
+
+		if when, ok := strings.CutPrefix(s, "  when: "); ok && len(entries) > 0 {
+			if sec, err := strconv.ParseInt(strings.TrimSpace(when), 10, 64); err == nil {
+				entries[len(entries)-1].timestamp = time.Unix(sec, 0)
+			}
+		}
+	}
+	return entries
+}
+
+// unescapeFish decodes a command from fish's history file, in which newlines
+// and backslashes are escaped.
+func unescapeFish(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case 'n':
+				sb.WriteByte('\n')
+				i++
+				continue
+			case '\\':
+				sb.WriteByte('\\')
+				i++
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// parsePwshHistory parses PSReadLine's ConsoleHost_history.txt file.
+// Multi-line commands are stored with a backtick at the end of each line but
+// the last.
+func parsePwshHistory(scanner *bufio.Scanner) []*historyEntry {
+	var entries []*historyEntry
+	for scanner.Scan() {
+		e := &historyEntry{command: scanner.Text()}
+		for strings.HasSuffix(e.command, "`") && scanner.Scan() {
+			e.command = e.command[:len(e.command)-1] + "\n" + scanner.Text()
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
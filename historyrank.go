@@ -0,0 +1,101 @@
+package grep
+
+import (
+	"sort"
+	"time"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+const (
+	frequencyRank = "frequency"
+	recencyRank   = "recency"
+	frecencyRank  = "frecency"
+)
+
+var (
+	rankOrders = []string{frequencyRank, recencyRank, frecencyRank}
+	rankFlag   = commander.BoolFlag("rank", 'R', "Collapse identical commands into one result (with a count), ordered by the rank-by flag")
+	rankByFlag = commander.Flag[string]("rank-by", commander.FlagNoShortName, "How ranked commands are ordered: frequency (the default), recency, or frecency (frequency weighted by recency)", commander.InList(rankOrders...), commander.SimpleCompleter[string](rankOrders...))
+)
+
+// rankHistory collapses identical matching commands and orders them by the
+// rank-by flag. Entries must be in chronological order.
+func rankHistory(entries []*historyEntry, f filter, data *command.Data) []*historyResult {
+	byCommand := map[string]*historyResult{}
+	// nonMatches contains commands that were already checked and didn't match.
+	nonMatches := map[string]bool{}
+	var ranked []*historyResult
+	for i, e := range entries {
+		cmd := e.commandWithoutNumber()
+		if nonMatches[cmd] {
+			continue
+		}
+
+		rc, ok := byCommand[cmd]
+		if !ok {
+			formattedString, ok := applyNoUnique(f, cmd, data)
+			if !ok {
+				nonMatches[cmd] = true
+				continue
+			}
+			rc = &historyResult{command: cmd, formattedString: formattedString}
+			byCommand[cmd] = rc
+			ranked = append(ranked, rc)
+		}
+
+		rc.count++
+		rc.last = i
+		if e.timestamp.After(rc.timestamp) {
+			rc.timestamp = e.timestamp
+		}
+		rc.frecency += frecencyWeight(e, len(entries)-1-i)
+	}
+
+	// Ties are broken by recency.
+	var score func(*historyResult) float64
+	switch rankByFlag.Get(data) {
+	case recencyRank:
+		score = func(rc *historyResult) float64 { return 0 }
+	case frecencyRank:
+		score = func(rc *historyResult) float64 { return rc.frecency }
+	default:
+		score = func(rc *historyResult) float64 { return float64(rc.count) }
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		si, sj := score(ranked[i]), score(ranked[j])
+		if si != sj {
+			return si > sj
+		}
+		return ranked[i].last > ranked[j].last
+	})
+	return ranked
+}
+
+// frecencyWeight returns the weight of a single history entry. More recent
+// entries have a higher weight. If the entry has no timestamp, then its age
+// is measured by the number of entries that came after it.
+func frecencyWeight(e *historyEntry, newerEntries int) float64 {
+	if !e.timestamp.IsZero() {
+		switch age := timeNow().Sub(e.timestamp); {
+		case age < time.Hour:
+			return 4
+		case age < 24*time.Hour:
+			return 2
+		case age < 7*24*time.Hour:
+			return 0.5
+		}
+		return 0.25
+	}
+
+	switch {
+	case newerEntries < 10:
+		return 4
+	case newerEntries < 100:
+		return 2
+	case newerEntries < 1000:
+		return 0.5
+	}
+	return 0.25
+}
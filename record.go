@@ -0,0 +1,96 @@
+package grep
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+var (
+	recordStartFlag = commander.Flag[string]("record-start", commander.FlagNoShortName, "Group lines into records that start with a line matching this regex (e.g. for stack traces or multi-line log entries). Each record is matched as a whole", commander.IsRegex())
+	paragraphFlag   = commander.BoolFlag("paragraph", commander.FlagNoShortName, "Group lines into records separated by blank lines. Each record is matched as a whole")
+)
+
+// checkRecordFlags returns an error if incompatible record flags are provided.
+func checkRecordFlags(output command.Output, data *command.Data) error {
+	if data.Has(recordStartFlag.Name()) && paragraphFlag.Get(data) {
+		return output.Stderrln("only one of --record-start and --paragraph can be provided")
+	}
+	return nil
+}
+
+// recordReader groups the lines of a scanner into (multi-line) records.
+type recordReader struct {
+	scanner *bufio.Scanner
+	// start matches the first line of a record. If nil, then records are
+	// separated by blank lines.
+	start *regexp.Regexp
+
+	lineCount int
+
+	// pending is the line that started the next record. It's read while
+	// looking for the end of the previous record.
+	pending     string
+	pendingLine int
+	hasPending  bool
+}
+
+// newRecordReader returns a record reader based on the provided flags (or nil
+// if records aren't used).
+func newRecordReader(data *command.Data, scanner *bufio.Scanner) *recordReader {
+	if data.Has(recordStartFlag.Name()) {
+		// The IsRegex validator ensures this is valid.
+		return &recordReader{
+			scanner: scanner,
+			start:   regexp.MustCompile(recordStartFlag.Get(data)),
+		}
+	}
+	if paragraphFlag.Get(data) {
+		return &recordReader{scanner: scanner}
+	}
+	return nil
+}
+
+// next returns the next record (with lines joined by newlines) and the line
+// number of its first line. Lines before the first start line form their own
+// record. In paragraph mode, blank lines aren't included in any record.
+func (rr *recordReader) next() (string, int, bool) {
+	var lines []string
+	var startLine int
+	if rr.hasPending {
+		lines = append(lines, rr.pending)
+		startLine = rr.pendingLine
+		rr.hasPending = false
+	}
+
+	for rr.scanner.Scan() {
+		rr.lineCount++
+		s := rr.scanner.Text()
+		if rr.start != nil {
+			if len(lines) > 0 && rr.start.MatchString(s) {
+				rr.pending = s
+				rr.pendingLine = rr.lineCount
+				rr.hasPending = true
+				break
+			}
+		} else if strings.TrimSpace(s) == "" {
+			if len(lines) > 0 {
+				break
+			}
+			continue
+		}
+
+		if len(lines) == 0 {
+			startLine = rr.lineCount
+		}
+		lines = append(lines, s)
+	}
+
+	if len(lines) == 0 {
+		return "", 0, false
+	}
+	return strings.Join(lines, "\n"), startLine, true
+}
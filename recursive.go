@@ -8,7 +8,6 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
-	"sort"
 	"strings"
 
 	"github.com/leep-frog/command/color"
@@ -17,22 +16,25 @@ import (
 )
 
 var (
-	startDir = "."
-	osOpen   = func(s string) (io.Reader, error) { return os.Open(s) }
-
-	ignoreFilePattern = commander.ListArg[string]("IGNORE_PATTERN", "Files that match these will be ignored", 1, command.UnboundedList, commander.ListifyValidatorOption(commander.IsRegex()))
-
-	ignoreIgnoreFiles = commander.BoolFlag("ignore-ignore-files", 'x', "Ignore the provided IGNORE_PATTERNS")
-	fileArg           = commander.Flag[string]("file", 'f', "Only select files that match this pattern")
-	invertFileArg     = commander.Flag[string]("invert-file", 'F', "Only select files that don't match this pattern")
-	hideFileFlag      = commander.BoolFlag("hide-file", 'h', "Don't show file names")
-	fileOnlyFlag      = commander.BoolFlag("file-only", 'l', "Only show file names")
-	beforeFlag        = commander.Flag[int]("before", 'b', "Show the matched line and the n lines before it")
-	afterFlag         = commander.Flag[int]("after", 'a', "Show the matched line and the n lines after it")
-	depthFlag         = commander.Flag[int]("depth", 'd', "The depth of files to search", commander.NonNegative[int]())
-	dirFlag           = commander.Flag[string]("directory", 'D', "Search through the provided directory instead of pwd", &commander.FileCompleter[string]{IgnoreFiles: true})
-	hideLineFlag      = commander.BoolFlag("hide-lines", 'n', "Don't include the line number in the output")
-	wholeFile         = commander.BoolFlag("whole-file", 'w', "Whether or not to search the whole file (i.e. multi-wrap searching) in one regex")
+	startDir           = "."
+	osOpen             = func(s string) (io.Reader, error) { return os.Open(s) }
+	osStat             = os.Stat
+	osStdin  io.Reader = os.Stdin
+
+	fileArg         = commander.Flag[string]("file", 'f', "Only select files that match this pattern")
+	invertFileArg   = commander.Flag[string]("invert-file", 'F', "Only select files that don't match this pattern")
+	hideFileFlag    = commander.BoolFlag("hide-file", 'h', "Don't show file names")
+	fileOnlyFlag    = commander.BoolFlag("file-only", 'l', "Only show file names")
+	beforeFlag      = commander.Flag[int]("before", 'b', "Show the matched line and the n lines before it")
+	afterFlag       = commander.Flag[int]("after", 'a', "Show the matched line and the n lines after it")
+	depthFlag       = commander.Flag[int]("depth", 'd', "The depth of files to search", commander.NonNegative[int]())
+	hideLineFlag    = commander.BoolFlag("hide-lines", 'n', "Don't include the line number in the output")
+	wholeFile       = commander.BoolFlag("whole-file", 'w', "Whether or not to search the whole file (i.e. multi-wrap searching) in one regex")
+	strictFlag      = commander.BoolFlag("strict", commander.FlagNoShortName, "Stop searching at the first file or directory that can't be read")
+	readSpecialFlag = commander.BoolFlag("read-special", commander.FlagNoShortName, "Read FIFOs, sockets, and device files instead of skipping them")
+	passthruFlag    = commander.BoolFlag("passthru", commander.FlagNoShortName, "Print every line (not just matching ones), highlighting the matches. The before and after flags are ignored")
+	gutterFlag      = commander.BoolFlag("gutter", commander.FlagNoShortName, "With --passthru, prefix matching lines with a marker")
+	filesFromFlag   = commander.Flag[string]("files-from", commander.FlagNoShortName, "Search the files (and directories) listed in this file (one per line) instead of the current directory. Use `-` to read the list from stdin (e.g. `git diff --name-only | rp PATTERN --files-from -`)")
 
 	fileColor = color.Yellow
 
@@ -46,10 +48,7 @@ func RecursiveCLI() *Grep {
 }
 
 type recursive struct {
-	// TODO: add way to get this from other command
-	DirectoryAliases   map[string]string
-	IgnoreFilePatterns map[string]bool
-	changed            bool
+	walkConfig
 }
 
 func (*recursive) Name() string {
@@ -63,100 +62,34 @@ func (*recursive) Flags() []commander.FlagInterface {
 		invertFileArg,
 		hideFileFlag,
 		fileOnlyFlag,
+		print0Flag,
 		beforeFlag,
 		afterFlag,
+		passthruFlag,
+		gutterFlag,
 		depthFlag,
+		minDepthFlag,
 		dirFlag,
 		hideLineFlag,
 		ignoreIgnoreFiles,
+		strictFlag,
+		readSpecialFlag,
+		followFlag,
+		filesFromFlag,
+		sinceFlag,
+		untilFlag,
+		timeFormatFlag,
+		sortedFlag,
+		recordStartFlag,
+		paragraphFlag,
 	}
 }
 
-func (r *recursive) addIgnorePattern(output command.Output, data *command.Data) error {
-	if r.IgnoreFilePatterns == nil {
-		r.IgnoreFilePatterns = map[string]bool{}
-	}
-	for _, pattern := range data.StringList(ignoreFilePattern.Name()) {
-		r.IgnoreFilePatterns[pattern] = true
-	}
-	r.changed = true
-	return nil
-}
-
-func (r *recursive) deleteIgnorePattern(output command.Output, data *command.Data) error {
-	if r.IgnoreFilePatterns == nil {
-		return nil
-	}
-	for _, pattern := range data.StringList(ignoreFilePattern.Name()) {
-		delete(r.IgnoreFilePatterns, pattern)
-	}
-	r.changed = true
-	return nil
-}
-
-func (r *recursive) listIgnorePattern(output command.Output, data *command.Data) error {
-	var patterns []string
-	for p := range r.IgnoreFilePatterns {
-		patterns = append(patterns, p)
-	}
-	sort.Strings(patterns)
-	for _, p := range patterns {
-		output.Stdoutln(p)
-	}
-	return nil
-}
-
 func (r *recursive) MakeNode(n command.Node) command.Node {
-	f := commander.CompleterFromFunc(func(v []string, d *command.Data) (*command.Completion, error) {
-		var s []string
-		for p := range r.IgnoreFilePatterns {
-			s = append(s, p)
-		}
-		return &command.Completion{
-			Suggestions: s,
-		}, nil
-	})
-	return &commander.BranchNode{
-		Branches: map[string]command.Node{
-			"if": commander.SerialNodes(
-				commander.Description("Commands around global ignore file patterns"),
-				&commander.BranchNode{
-					Branches: map[string]command.Node{
-						"a": commander.SerialNodes(
-							commander.Description("Add a global file ignore pattern"),
-							ignoreFilePattern,
-							&commander.ExecutorProcessor{F: r.addIgnorePattern},
-						),
-						"d": commander.SerialNodes(
-							commander.Description("Deletes a global file ignore pattern"),
-							ignoreFilePattern.AddOptions(f),
-							&commander.ExecutorProcessor{F: r.deleteIgnorePattern},
-						),
-						"l": commander.SerialNodes(
-							commander.Description("List global file ignore patterns"),
-							&commander.ExecutorProcessor{F: r.listIgnorePattern},
-						),
-					},
-				},
-			),
-		},
-		Default: n,
-	}
+	return r.makeNode(n, nil)
 }
 
-func (r *recursive) Changed() bool {
-	return r.changed
-}
-
-func (r *recursive) Process(output command.Output, data *command.Data, fltr filter, ss *sliceSet) error {
-	var nameRegexes []*regexp.Regexp
-
-	if !ignoreIgnoreFiles.Get(data) {
-		for ifp := range r.IgnoreFilePatterns {
-			// ListIsRegex ArgumentOption ensures that these regexes are valid, so it's okay to use MustCompile here.
-			nameRegexes = append(nameRegexes, regexp.MustCompile(ifp))
-		}
-	}
+func (r *recursive) Process(output command.Output, data *command.Data, fltr filter, ss *sliceSet, res *searchResult) error {
 	var fr *regexp.Regexp
 
 	if data.Has(fileArg.Name()) {
@@ -176,30 +109,47 @@ func (r *recursive) Process(output command.Output, data *command.Data, fltr filt
 		}
 	}
 
-	dir := startDir
-	if data.Has(dirFlag.Name()) {
-		da := data.String(dirFlag.Name())
-		var ok bool
-		dir, ok = r.DirectoryAliases[da]
-		if !ok {
-			return output.Stderrf("unknown alias: %q\n", da)
-		}
+	if err := checkRecordFlags(output, data); err != nil {
+		return err
+	}
+
+	if print0Flag.Get(data) && !fileOnlyFlag.Get(data) {
+		return output.Stderrln("--print0 requires --file-only")
 	}
 
-	maxDepth := depthFlag.GetOrDefault(data, 0)
+	dir, err := r.root(output, data)
+	if err != nil {
+		return err
+	}
 
-	return filepath.WalkDir(dir, func(path string, de fs.DirEntry, err error) error {
+	var paths []string
+	if data.Has(filesFromFlag.Name()) {
+		if data.Has(dirFlag.Name()) {
+			return output.Stderrln("only one of --directory and --files-from can be provided")
+		}
+		var err error
+		if paths, err = readFilesFrom(filesFromFlag.Get(data)); err != nil {
+			return output.Stderrf("failed to read file list: %v\n", err)
+		}
+	}
+
+	// stopped is set when the search should stop (rather than just the walk
+	// of the current path).
+	var stopped bool
+	skipped := &skippedPaths{strict: strictFlag.Get(data)}
+	w, err := r.newWalker(output, data)
+	if err != nil {
+		return err
+	}
+	w.fn = func(path string, de fs.DirEntry, err error) error {
 		if err != nil {
 			if os.IsNotExist(err) {
-				return output.Stderrf("file not found: %s\n", path)
+				return skipped.add(output, "file not found: %s", path)
 			}
-			return output.Stderrf("failed to access path %q: %v\n", path, err)
+			return skipped.add(output, "failed to access path %q: %v", path, err)
 		}
 
 		if de.IsDir() {
-			if maxDepth > 0 && strings.Count(path, string(os.PathSeparator)) >= maxDepth {
-				return fs.SkipDir
-			}
 			return nil
 		}
 
@@ -211,48 +161,180 @@ func (r *recursive) Process(output command.Output, data *command.Data, fltr filt
 			return nil
 		}
 
-		for _, r := range nameRegexes {
-			if r.MatchString(de.Name()) {
-				return nil
-			}
+		ok, err := shouldOpen(path, de, readSpecialFlag.Get(data))
+		if err != nil {
+			return skipped.add(output, "failed to resolve symlink %q: %v", path, err)
+		}
+		if !ok {
+			return nil
 		}
 
 		f, err := osOpen(path)
 		if err != nil {
-			return output.Stderrf("failed to open file %q: %v\n", path, err)
+			return skipped.add(output, "failed to open file %q: %v", path, err)
+		}
+		// The file is closed once the list has been drained (or the search
+		// stops), so large trees don't run out of file descriptors.
+		if c, ok := f.(io.Closer); ok {
+			defer c.Close()
 		}
 
 		scanner := bufio.NewScanner(f)
 		list := newLinkedList(fltr, data, scanner)
 		for formattedString, line, ok := list.getNext(ss); ok; formattedString, line, ok = list.getNext(ss) {
+			if list.isMatch() {
+				res.matched = true
+			}
 			if data.Bool(fileOnlyFlag.Name()) {
-				applyFormatWithColor(output, data, fileColor, []string{"", path})
-				output.Stdoutln()
+				if print0Flag.Get(data) {
+					output.Stdoutf("%s\x00", path)
+				} else {
+					applyFormatWithColor(output, data, fileColor, []string{"", path})
+					output.Stdoutln()
+				}
+				if stopAfterMatch(data) {
+					stopped = true
+					return fs.SkipAll
+				}
 				break
 			}
 
+			lineOutput := passthruOutput(output, data, list)
 			var needColon bool
 			if !data.Bool(hideFileFlag.Name()) {
-				applyFormatWithColor(output, data, fileColor, []string{"", path})
+				applyFormatWithColor(lineOutput, data, fileColor, []string{"", path})
 				needColon = true
 			}
 			if !data.Bool(hideLineFlag.Name()) {
 				if needColon {
-					output.Stdout(":")
+					lineOutput.Stdout(":")
 				} else {
 					needColon = true
 				}
-				applyFormatWithColor(output, data, lineColor, []string{"", fmt.Sprintf("%d", line)})
+				applyFormatWithColor(lineOutput, data, lineColor, []string{"", fmt.Sprintf("%d", line)})
 			}
 			if needColon {
-				output.Stdout(":")
+				lineOutput.Stdout(":")
+			}
+			applyFormat(lineOutput, data, formattedString)
+			lineOutput.Stdoutln()
+			if stopAfterMatch(data) {
+				stopped = true
+				return fs.SkipAll
 			}
-			applyFormat(output, data, formattedString)
-			output.Stdoutln()
 		}
 
 		return nil
-	})
+	}
+
+	if !data.Has(filesFromFlag.Name()) {
+		paths = []string{dir}
+	}
+	for _, path := range paths {
+		if data.Has(filesFromFlag.Name()) {
+			// Listed files are ignored just like walked ones are (unless
+			// --ignore-ignore-files is set).
+			if w.ignored(filepath.Base(path)) {
+				continue
+			}
+			// Listed files are often generated by other commands (and may be
+			// stale), so missing files aren't treated as errors.
+			if _, err := os.Lstat(path); os.IsNotExist(err) {
+				output.Stderrf("warning: file not found: %s\n", path)
+				continue
+			}
+		}
+		if err := w.walk(path); err != nil {
+			return err
+		}
+		if stopped {
+			break
+		}
+	}
+	// Skipped paths don't affect the exit code (which is based on whether
+	// anything matched), so the summary is only a warning.
+	skipped.summary(output)
+	return nil
+}
+
+// readFilesFrom returns the (non-empty) lines of the provided file (or of
+// stdin if the file is `-`). Only line endings are removed, since paths can
+// start or end with spaces.
+func readFilesFrom(filename string) ([]string, error) {
+	r := osStdin
+	if filename != "-" {
+		var err error
+		if r, err = osOpen(filename); err != nil {
+			return nil, err
+		}
+		if c, ok := r.(io.Closer); ok {
+			defer c.Close()
+		}
+	}
+
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if p := strings.TrimSuffix(scanner.Text(), "\r"); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths, scanner.Err()
+}
+
+// specialFileMode contains the mode bits for files that aren't regular files
+// and that may block forever when read (e.g. FIFOs).
+const specialFileMode = fs.ModeNamedPipe | fs.ModeSocket | fs.ModeDevice | fs.ModeCharDevice | fs.ModeIrregular
+
+// shouldOpen returns whether or not the (non-directory) walked entry should
+// be opened and searched. Symlinks are resolved so the decision is made
+// based on the target: symlinked directories are not descended into, and
+// special files are only read if readSpecial is set.
+func shouldOpen(path string, de fs.DirEntry, readSpecial bool) (bool, error) {
+	mode := de.Type()
+	if mode&fs.ModeSymlink != 0 {
+		fi, err := osStat(path)
+		if err != nil {
+			return false, err
+		}
+		mode = fi.Mode()
+	}
+
+	if mode.IsDir() {
+		return false, nil
+	}
+	return readSpecial || mode&specialFileMode == 0, nil
+}
+
+// skippedPaths keeps track of the paths that were skipped because they
+// couldn't be accessed or opened.
+type skippedPaths struct {
+	// strict indicates whether the walk should stop at the first error.
+	strict  bool
+	reasons []string
+}
+
+// add records the skipped path. It returns an error (and writes it to stderr)
+// only if strict is set. Otherwise, nil is returned so the walk continues.
+func (sp *skippedPaths) add(output command.Output, format string, a ...interface{}) error {
+	if sp.strict {
+		return output.Stderrf(format+"\n", a...)
+	}
+	sp.reasons = append(sp.reasons, fmt.Sprintf(format, a...))
+	return nil
+}
+
+// summary writes a warning with the number of skipped paths, and the reason
+// each one was skipped, to stderr.
+func (sp *skippedPaths) summary(output command.Output) {
+	if len(sp.reasons) == 0 {
+		return
+	}
+	pathStr := "paths"
+	if len(sp.reasons) == 1 {
+		pathStr = "path"
+	}
+	output.Stderrf("warning: skipped %d %s:\n  %s\n", len(sp.reasons), pathStr, strings.Join(sp.reasons, "\n  "))
 }
 
 type element struct {
@@ -277,6 +359,27 @@ type linkedList struct {
 	// lastMatch contains how many lines ago a match was found.
 	lastMatch int
 	scanner   *bufio.Scanner
+	// nextLine, if set, is used to get lines instead of the scanner.
+	nextLine func() (string, bool)
+	// records, if set, groups lines into multi-line records, each of which
+	// is treated as a single line.
+	records *recordReader
+	// window, if set, limits the lines that are searched to a time window.
+	window *timeWindow
+	// stripANSI indicates whether ANSI escape sequences should be removed
+	// from lines before they're searched.
+	stripANSI bool
+	// keepANSI indicates whether the (stripped) escape sequences should be
+	// restored outside of matched segments.
+	keepANSI bool
+	// passthru indicates whether every line should be returned (not just
+	// matches and their context). matched indicates whether the most
+	// recently returned line was a match.
+	passthru bool
+	matched  bool
+	// reject, if set, is called for every line that isn't a match (including
+	// lines outside of the time window).
+	reject func(s string, lineNumber int)
 
 	clearBefores bool
 }
@@ -287,6 +390,11 @@ func newLinkedList(fltr filter, data *command.Data, scanner *bufio.Scanner) *lin
 		after:   data.Int(afterFlag.Name()),
 		filter:  fltr,
 		scanner: scanner,
+		records: newRecordReader(data, scanner),
+		window:  newTimeWindow(data),
+		// Quiet mode only cares about matches, and file-only mode would
+		// print every file.
+		passthru: passthruFlag.Get(data) && !stopAfterMatch(data) && !fileOnlyFlag.Get(data),
 
 		data: data,
 
@@ -306,14 +414,39 @@ func (ll *linkedList) getNext(ss *sliceSet) ([]string, int, bool) {
 		}
 
 		// Otherwise, look for lines to return.
-		ll.lineCount++
-		if !ll.scanner.Scan() {
+		s, ok := ll.read()
+		if !ok {
 			return nil, 0, false
 		}
-		s := ll.scanner.Text()
+		original := s
+		if ll.stripANSI {
+			s = stripANSI(s)
+		}
+
+		// Ignore lines outside of the time window (but still count them so
+		// line numbers are correct).
+		if ll.window != nil {
+			in, done := ll.window.check(s)
+			if done {
+				return nil, 0, false
+			}
+			if !in {
+				if ll.reject != nil {
+					ll.reject(s, ll.lineCount)
+				}
+				continue
+			}
+		}
 
 		// If we got a match, then update lastMatch and print this line and any previous ones.
 		if formattedString, ok := apply(ll.filter, s, ll.data, ss); ok {
+			if ll.keepANSI {
+				formattedString = restoreANSI(original, formattedString)
+			}
+			if ll.passthru {
+				ll.matched = true
+				return formattedString, ll.lineCount, true
+			}
 			ll.lastMatch = 0
 			ll.pushBack(formattedString, ll.lineCount)
 			ll.clearBefores = true
@@ -322,6 +455,16 @@ func (ll *linkedList) getNext(ss *sliceSet) ([]string, int, bool) {
 
 		// Otherwise, increment lastMatch.
 		ll.lastMatch++
+		if ll.reject != nil {
+			ll.reject(s, ll.lineCount)
+		}
+		if ll.keepANSI {
+			s = original
+		}
+		if ll.passthru {
+			ll.matched = false
+			return []string{s}, ll.lineCount, true
+		}
 
 		// If we are still in the "after" window from our last match,
 		// then we want to print out this line.
@@ -338,6 +481,49 @@ func (ll *linkedList) getNext(ss *sliceSet) ([]string, int, bool) {
 	}
 }
 
+// read returns the next line (or record) and updates lineCount to its line
+// number.
+func (ll *linkedList) read() (string, bool) {
+	if ll.records != nil {
+		s, n, ok := ll.records.next()
+		ll.lineCount = n
+		return s, ok
+	}
+	ll.lineCount++
+	if ll.nextLine != nil {
+		return ll.nextLine()
+	}
+	if !ll.scanner.Scan() {
+		return "", false
+	}
+	return ll.scanner.Text(), true
+}
+
+// isMatch returns whether the line that was most recently returned by the
+// list indicates a match. Outside of passthru mode, lines (including context
+// lines) are only returned if there was a match.
+func (ll *linkedList) isMatch() bool {
+	return !ll.passthru || ll.matched
+}
+
+// passthruOutput returns the output to use for the line that was most
+// recently returned by the list. In passthru mode, a gutter marker is written
+// if requested.
+func passthruOutput(output command.Output, data *command.Data, ll *linkedList) command.Output {
+	if !ll.passthru {
+		return output
+	}
+	if gutterFlag.Get(data) {
+		if ll.matched {
+			applyFormat(output, data, []string{"", ">"})
+			output.Stdout(" ")
+		} else {
+			output.Stdout("  ")
+		}
+	}
+	return output
+}
+
 func (ll *linkedList) pushBack(ss []string, i int) {
 	newEl := &element{
 		value: ss,
@@ -3,11 +3,16 @@ package grep
 import (
 	"fmt"
 	"io"
+	"io/fs"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/leep-frog/command/cache"
 	"github.com/leep-frog/command/command"
 	"github.com/leep-frog/command/commandertest"
 	"github.com/leep-frog/command/commandtest"
@@ -18,6 +23,13 @@ func testName(sc bool, name string) string {
 }
 
 func TestRecursive(t *testing.T) {
+	absTesting := commandtest.FilepathAbs(t, "testing")
+	absOther := commandtest.FilepathAbs(t, "testing", "other")
+	absThis := commandtest.FilepathAbs(t, "testing", "this.txt")
+	filesFrom := filepath.Join(t.TempDir(), "files.txt")
+	if err := os.WriteFile(filesFrom, []byte(filepath.Join("testing", "that.py")+"\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
 	for _, sc := range []bool{true, false} {
 		commandtest.StubValue(t, &defaultColorValue, sc)
 		fakeColor := fakeColorFn(sc)
@@ -36,26 +48,81 @@ func TestRecursive(t *testing.T) {
 			ignorePatterns map[string]bool
 			stubDir        string
 			osOpenErr      error
+			osOpenErrFile  string
+			stdin          string
 			etc            *commandtest.ExecuteTestCase
-			want           *recursive
+			wantSettings   *walkSettings
 			dontColor      bool
 		}{
 			{
-				name:    "errors on walk error",
+				name:    "warns on walk error",
+				stubDir: "does-not-exist",
+				etc: &commandtest.ExecuteTestCase{
+					WantStderr: "warning: skipped 1 path:\n  file not found: does-not-exist\n",
+				},
+			},
+			{
+				name:    "errors on walk error with strict flag",
 				stubDir: "does-not-exist",
 				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"--strict"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							strictFlag.Name(): true,
+						},
+					},
 					WantStderr: "file not found: does-not-exist\n",
 					WantErr:    fmt.Errorf(`file not found: does-not-exist`),
 				},
 			},
 			{
-				name:      "errors on open error",
+				name:      "warns on open error",
+				osOpenErr: fmt.Errorf("oops"),
+				etc: &commandtest.ExecuteTestCase{
+					WantStderr: strings.Join([]string{
+						"warning: skipped 5 paths:",
+						fmt.Sprintf("  failed to open file %q: oops", filepath.Join("testing", "lots.txt")),
+						fmt.Sprintf("  failed to open file %q: oops", filepath.Join("testing", "numbered.txt")),
+						fmt.Sprintf("  failed to open file %q: oops", filepath.Join("testing", "other", "other.txt")),
+						fmt.Sprintf("  failed to open file %q: oops", filepath.Join("testing", "that.py")),
+						fmt.Sprintf("  failed to open file %q: oops", filepath.Join("testing", "this.txt")),
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name:      "errors on open error with strict flag",
 				osOpenErr: fmt.Errorf("oops"),
 				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"--strict"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							strictFlag.Name(): true,
+						},
+					},
 					WantStderr: fmt.Sprintf("failed to open file %q: oops\n", filepath.Join("testing", "lots.txt")),
 					WantErr:    fmt.Errorf(`failed to open file %q: oops`, filepath.Join("testing", "lots.txt")),
 				},
 			},
+			{
+				name:          "continues searching after open error",
+				osOpenErr:     fmt.Errorf("oops"),
+				osOpenErrFile: filepath.Join("testing", "lots.txt"),
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^alpha"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName: [][]string{{"^alpha"}},
+						},
+					},
+					WantStdout: strings.Join([]string{
+						withFile(withLine(1, fmt.Sprintf("%s%s", fakeColor(matchColor, "alpha"), " zero")), "testing", "other", "other.txt"),
+						withFile(withLine(1, fakeColor(matchColor, "alpha")), "testing", "that.py"),
+						"",
+					}, "\n"),
+					WantStderr: fmt.Sprintf("warning: skipped 1 path:\n  failed to open file %q: oops\n", filepath.Join("testing", "lots.txt")),
+				},
+			},
 			{
 				name: "finds matches",
 				etc: &commandtest.ExecuteTestCase{
@@ -458,6 +525,45 @@ func TestRecursive(t *testing.T) {
 					}, "\n"),
 				},
 			},
+			{
+				name: "returns matches for min depth of 2",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"alpha", "--min-depth", "2"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:      [][]string{{"alpha"}},
+							minDepthFlag.Name(): 2,
+						},
+					},
+					WantStdout: strings.Join([]string{
+						withFile(withLine(1, fmt.Sprintf("%s zero", fakeColor(matchColor, "alpha"))), "testing", "other", "other.txt"),
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "depth is relative to absolute directory alias",
+				aliases: map[string]string{
+					"abs": absTesting,
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"alpha", "-d", "1", "-D", "abs"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:   [][]string{{"alpha"}},
+							depthFlag.Name(): 1,
+							dirFlag.Name():   "abs",
+						},
+					},
+					WantStdout: strings.Join([]string{
+						withFile(withLine(1, fmt.Sprintf("%s bravo delta", fakeColor(matchColor, "alpha"))), absTesting, "lots.txt"),
+						withFile(withLine(2, fmt.Sprintf("bravo delta %s", fakeColor(matchColor, "alpha"))), absTesting, "lots.txt"),
+						withFile(withLine(3, fmt.Sprintf("%s hello there", fakeColor(matchColor, "alpha"))), absTesting, "lots.txt"),
+						withFile(withLine(1, fakeColor(matchColor, "alpha")), absTesting, "that.py"),
+						"",
+					}, "\n"),
+				},
+			},
 			// -a flag
 			{
 				name: "returns lines after",
@@ -729,6 +835,329 @@ func TestRecursive(t *testing.T) {
 					}, "\n"),
 				},
 			},
+			{
+				name: "quiet flag prints nothing",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^alpha", "-q"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:   [][]string{{"^alpha"}},
+							quietFlag.Name(): true,
+						},
+					},
+				},
+			},
+			{
+				name: "matches multi-line records",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"delta alpha", "-f", "lots", "--record-start", "^alpha"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:         [][]string{{"delta alpha"}},
+							fileArg.Name():         "lots",
+							recordStartFlag.Name(): "^alpha",
+						},
+					},
+					WantStdout: strings.Join([]string{
+						withFile(withLine(1, fmt.Sprintf("alpha bravo delta\nbravo %s", fakeColor(matchColor, "delta alpha"))), "testing", "lots.txt"),
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "fails if record-start and paragraph flags",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"--record-start", "^alpha", "--paragraph"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							recordStartFlag.Name(): "^alpha",
+							paragraphFlag.Name():   true,
+						},
+					},
+					WantStderr: "only one of --record-start and --paragraph can be provided\n",
+					WantErr:    fmt.Errorf("only one of --record-start and --paragraph can be provided"),
+				},
+			},
+			{
+				name: "prints NUL-terminated file names",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^alpha", "-l", "--print0"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:      [][]string{{"^alpha"}},
+							fileOnlyFlag.Name(): true,
+							print0Flag.Name():   true,
+						},
+					},
+					WantStdout: strings.Join([]string{
+						filepath.Join("testing", "lots.txt"),
+						filepath.Join("testing", "other", "other.txt"),
+						filepath.Join("testing", "that.py"),
+						"",
+					}, "\x00"),
+				},
+			},
+			{
+				name: "fails if print0 without file only flag",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^alpha", "--print0"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:    [][]string{{"^alpha"}},
+							print0Flag.Name(): true,
+						},
+					},
+					WantStderr: "--print0 requires --file-only\n",
+					WantErr:    fmt.Errorf("--print0 requires --file-only"),
+				},
+			},
+			{
+				name:  "searches files from stdin",
+				stdin: strings.Join([]string{filepath.Join("testing", "lots.txt"), "", "missing.txt", filepath.Join("testing", "other")}, "\n"),
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^alpha", "--files-from", "-"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:       [][]string{{"^alpha"}},
+							filesFromFlag.Name(): "-",
+						},
+					},
+					WantStdout: strings.Join([]string{
+						withFile(withLine(1, fmt.Sprintf("%s%s", fakeColor(matchColor, "alpha"), " bravo delta")), "testing", "lots.txt"),
+						withFile(withLine(3, fmt.Sprintf("%s%s", fakeColor(matchColor, "alpha"), " hello there")), "testing", "lots.txt"),
+						withFile(withLine(1, fmt.Sprintf("%s%s", fakeColor(matchColor, "alpha"), " zero")), "testing", "other", "other.txt"),
+						"",
+					}, "\n"),
+					WantStderr: "warning: file not found: missing.txt\n",
+				},
+			},
+			{
+				name:  "only removes line endings from files from stdin",
+				stdin: strings.Join([]string{filepath.Join("testing", "lots.txt"), " " + filepath.Join("testing", "other") + " ", ""}, "\r\n"),
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^alpha", "--files-from", "-"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:       [][]string{{"^alpha"}},
+							filesFromFlag.Name(): "-",
+						},
+					},
+					WantStdout: strings.Join([]string{
+						withFile(withLine(1, fmt.Sprintf("%s%s", fakeColor(matchColor, "alpha"), " bravo delta")), "testing", "lots.txt"),
+						withFile(withLine(3, fmt.Sprintf("%s%s", fakeColor(matchColor, "alpha"), " hello there")), "testing", "lots.txt"),
+						"",
+					}, "\n"),
+					WantStderr: fmt.Sprintf("warning: file not found:  %s \n", filepath.Join("testing", "other")),
+				},
+			},
+			{
+				name:  "searches files from stdin with file only flag",
+				stdin: strings.Join([]string{filepath.Join("testing", "that.py"), filepath.Join("testing", "this.txt"), filepath.Join("testing", "lots.txt")}, "\n"),
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^alpha", "--files-from", "-", "-l"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:       [][]string{{"^alpha"}},
+							filesFromFlag.Name(): "-",
+							fileOnlyFlag.Name():  true,
+						},
+					},
+					WantStdout: strings.Join([]string{
+						fakeColor(fileColor, filepath.Join("testing", "that.py")),
+						fakeColor(fileColor, filepath.Join("testing", "lots.txt")),
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name:           "ignores files from stdin that match ignore patterns",
+				ignorePatterns: map[string]bool{`\.py$`: true},
+				stdin:          strings.Join([]string{filepath.Join("testing", "that.py"), filepath.Join("testing", "lots.txt")}, "\n"),
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^alpha", "--files-from", "-", "-l"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:       [][]string{{"^alpha"}},
+							filesFromFlag.Name(): "-",
+							fileOnlyFlag.Name():  true,
+						},
+					},
+					WantStdout: strings.Join([]string{
+						fakeColor(fileColor, filepath.Join("testing", "lots.txt")),
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name:           "searches ignored files from stdin if ignore-ignore-files flag",
+				ignorePatterns: map[string]bool{`\.py$`: true},
+				stdin:          strings.Join([]string{filepath.Join("testing", "that.py"), filepath.Join("testing", "lots.txt")}, "\n"),
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^alpha", "--files-from", "-", "-l", "-x"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:           [][]string{{"^alpha"}},
+							filesFromFlag.Name():     "-",
+							fileOnlyFlag.Name():      true,
+							ignoreIgnoreFiles.Name(): true,
+						},
+					},
+					WantStdout: strings.Join([]string{
+						fakeColor(fileColor, filepath.Join("testing", "that.py")),
+						fakeColor(fileColor, filepath.Join("testing", "lots.txt")),
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "searches files from file",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^alpha", "--files-from", filesFrom, "-l"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:       [][]string{{"^alpha"}},
+							filesFromFlag.Name(): filesFrom,
+							fileOnlyFlag.Name():  true,
+						},
+					},
+					WantStdout: strings.Join([]string{
+						fakeColor(fileColor, filepath.Join("testing", "that.py")),
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "fails if files from file doesn't exist",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^alpha", "--files-from", "does-not-exist"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:       [][]string{{"^alpha"}},
+							filesFromFlag.Name(): "does-not-exist",
+						},
+					},
+					WantStderr: "failed to read file list: open does-not-exist: no such file or directory\n",
+					WantErr:    fmt.Errorf("failed to read file list: open does-not-exist: no such file or directory"),
+				},
+			},
+			{
+				name:    "fails if directory and files from flags",
+				aliases: map[string]string{"t": "testing"},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^alpha", "--files-from", "-", "-D", "t"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:       [][]string{{"^alpha"}},
+							filesFromFlag.Name(): "-",
+							dirFlag.Name():       "t",
+						},
+					},
+					WantStderr: "only one of --directory and --files-from can be provided\n",
+					WantErr:    fmt.Errorf("only one of --directory and --files-from can be provided"),
+				},
+			},
+			{
+				name: "passthru prints every line",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"Unique$", "-f", "this", "--passthru", "-a", "5"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:      [][]string{{"Unique$"}},
+							fileArg.Name():      "this",
+							passthruFlag.Name(): true,
+							afterFlag.Name():    5,
+						},
+					},
+					WantStdout: strings.Join([]string{
+						withFile(withLine(1, "bravo"), "testing", "this.txt"),
+						withFile(withLine(2, fmt.Sprintf("ZZZ%s", fakeColor(matchColor, "Unique"))), "testing", "this.txt"),
+						withFile(withLine(3, "ZZZUnique 2"), "testing", "this.txt"),
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "passthru with gutter",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"Unique$", "-f", "this", "--passthru", "--gutter", "-h"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:      [][]string{{"Unique$"}},
+							fileArg.Name():      "this",
+							passthruFlag.Name(): true,
+							gutterFlag.Name():   true,
+							hideFileFlag.Name(): true,
+						},
+					},
+					WantStdout: strings.Join([]string{
+						fmt.Sprintf("  %s", withLine(1, "bravo")),
+						fmt.Sprintf("%s %s", fakeColor(matchColor, ">"), withLine(2, fmt.Sprintf("ZZZ%s", fakeColor(matchColor, "Unique")))),
+						fmt.Sprintf("  %s", withLine(3, "ZZZUnique 2")),
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "passthru is ignored with file only flag",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"Unique$", "--passthru", "-l"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:      [][]string{{"Unique$"}},
+							passthruFlag.Name(): true,
+							fileOnlyFlag.Name(): true,
+						},
+					},
+					WantStdout: strings.Join([]string{
+						fakeColor(fileColor, filepath.Join("testing", "lots.txt")),
+						fakeColor(fileColor, filepath.Join("testing", "this.txt")),
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "ignore patterns prune directories",
+				ignorePatterns: map[string]bool{
+					`^other$`: true,
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^alp", "-l"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:      [][]string{{"^alp"}},
+							fileOnlyFlag.Name(): true,
+						},
+					},
+					WantStdout: strings.Join([]string{
+						fakeColor(fileColor, filepath.Join("testing", "lots.txt")), // "alpha bravo delta"
+						fakeColor(fileColor, filepath.Join("testing", "that.py")),  // "alpha"
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "ignore patterns don't apply to the searched directory",
+				aliases: map[string]string{
+					"ooo": "testing/other",
+				},
+				ignorePatterns: map[string]bool{
+					`^other$`: true,
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^alp", "-l", "-D", "ooo"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:      [][]string{{"^alp"}},
+							fileOnlyFlag.Name(): true,
+							dirFlag.Name():      "ooo",
+						},
+					},
+					WantStdout: strings.Join([]string{
+						fakeColor(fileColor, filepath.Join("testing", "other", "other.txt")), // "alpha zero"
+						"",
+					}, "\n"),
+				},
+			},
 			// Ignore file patterns
 			{
 				name: "ignore file pattern requires argument",
@@ -769,7 +1198,7 @@ func TestRecursive(t *testing.T) {
 						},
 					},
 				},
-				want: &recursive{
+				wantSettings: &walkSettings{
 					IgnoreFilePatterns: map[string]bool{
 						".binary$": true,
 					},
@@ -788,7 +1217,7 @@ func TestRecursive(t *testing.T) {
 						},
 					},
 				},
-				want: &recursive{
+				wantSettings: &walkSettings{
 					IgnoreFilePatterns: map[string]bool{
 						".binary$": true,
 						"other":    true,
@@ -808,7 +1237,7 @@ func TestRecursive(t *testing.T) {
 						},
 					},
 				},
-				want: &recursive{
+				wantSettings: &walkSettings{
 					IgnoreFilePatterns: map[string]bool{
 						".bin":  true,
 						"ary$":  true,
@@ -854,7 +1283,7 @@ func TestRecursive(t *testing.T) {
 						},
 					},
 				},
-				want: &recursive{
+				wantSettings: &walkSettings{
 					IgnoreFilePatterns: map[string]bool{
 						"other": true,
 					},
@@ -881,6 +1310,108 @@ func TestRecursive(t *testing.T) {
 					}, "\n"),
 				},
 			},
+			// Directory aliases
+			{
+				name: "adds directory alias",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"da", "a", "ooo", filepath.Join("testing", "other")},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							aliasArg.Name():    "ooo",
+							aliasDirArg.Name(): absOther,
+						},
+					},
+				},
+				wantSettings: &walkSettings{
+					DirectoryAliases: map[string]string{
+						"ooo": absOther,
+					},
+				},
+			},
+			{
+				name: "overrides directory alias",
+				aliases: map[string]string{
+					"ooo": "somewhere",
+					"t":   "testing",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"da", "a", "ooo", filepath.Join("testing", "other")},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							aliasArg.Name():    "ooo",
+							aliasDirArg.Name(): absOther,
+						},
+					},
+				},
+				wantSettings: &walkSettings{
+					DirectoryAliases: map[string]string{
+						"ooo": absOther,
+						"t":   "testing",
+					},
+				},
+			},
+			{
+				name: "directory alias must be a directory",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"da", "a", "ooo", filepath.Join("testing", "this.txt")},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							aliasArg.Name():    "ooo",
+							aliasDirArg.Name(): absThis,
+						},
+					},
+					WantStderr: fmt.Sprintf("validation for \"DIRECTORY\" failed: [IsDir] argument %q is a file\n", absThis),
+					WantErr:    fmt.Errorf("validation for \"DIRECTORY\" failed: [IsDir] argument %q is a file", absThis),
+				},
+			},
+			{
+				name: "deletes directory alias",
+				aliases: map[string]string{
+					"ooo": "testing/other",
+					"t":   "testing",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"da", "d", "ooo"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							aliasArg.Name(): "ooo",
+						},
+					},
+				},
+				wantSettings: &walkSettings{
+					DirectoryAliases: map[string]string{
+						"t": "testing",
+					},
+				},
+			},
+			{
+				name: "errors when deleting unknown directory alias",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"da", "d", "ooo"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							aliasArg.Name(): "ooo",
+						},
+					},
+					WantStderr: "unknown alias: \"ooo\"\n",
+					WantErr:    fmt.Errorf(`unknown alias: "ooo"`),
+				},
+			},
+			{
+				name: "lists directory aliases",
+				aliases: map[string]string{
+					"ooo": "testing/other",
+					"t":   "testing",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"da", "l"},
+					WantStdout: strings.Join([]string{
+						"ooo: testing/other",
+						"t: testing",
+						"",
+					}, "\n"),
+				},
+			},
 			/* Useful for commenting out tests. */
 		} {
 			t.Run(testName(sc, test.name), func(t *testing.T) {
@@ -891,40 +1422,87 @@ func TestRecursive(t *testing.T) {
 				}
 				commandtest.StubValue(t, &startDir, tmpStart)
 
-				// Stub os.Open if necessary
-				if test.osOpenErr != nil {
-					commandtest.StubValue(t, &osOpen, func(s string) (io.Reader, error) { return nil, test.osOpenErr })
+				// Stub os.Open so opened files can be checked to be closed.
+				var opened []*closeTracker
+				commandtest.StubValue(t, &osOpen, func(s string) (io.Reader, error) {
+					if test.osOpenErr != nil && (test.osOpenErrFile == "" || s == test.osOpenErrFile) {
+						return nil, test.osOpenErr
+					}
+					f, err := os.Open(s)
+					if err != nil {
+						return nil, err
+					}
+					ct := &closeTracker{ReadCloser: f, name: s}
+					opened = append(opened, ct)
+					return ct, nil
+				})
+
+				if test.stdin != "" {
+					commandtest.StubValue(t, &osStdin, io.Reader(strings.NewReader(test.stdin)))
 				}
 
-				r := &Grep{
-					InputSource: &recursive{
-						DirectoryAliases:   test.aliases,
-						IgnoreFilePatterns: test.ignorePatterns,
-					},
+				settings := &walkSettings{
+					DirectoryAliases:   test.aliases,
+					IgnoreFilePatterns: test.ignorePatterns,
 				}
-				var g *Grep
-				if test.want != nil {
-					g = &Grep{
-						InputSource: test.want,
-					}
+				getSettings := stubWalkSettings(t, settings)
+
+				r := &Grep{
+					InputSource: &recursive{},
 				}
 				test.etc.Node = r.Node()
 				commandertest.ExecuteTest(t, test.etc)
-				commandertest.ChangeTest(t, g, r, cmpopts.IgnoreUnexported(recursive{}))
+				commandertest.ChangeTest(t, nil, r)
+
+				// Settings are only saved in the shared store.
+				wantSettings := test.wantSettings
+				if wantSettings == nil {
+					wantSettings = settings
+				}
+				if diff := cmp.Diff(wantSettings, getSettings(), cmpopts.EquateEmpty()); diff != "" {
+					t.Errorf("rp produced incorrect walk settings (-want, +got):\n%s", diff)
+				}
+				for _, ct := range opened {
+					if !ct.closed {
+						t.Errorf("rp didn't close file %q", ct.name)
+					}
+				}
 			})
 		}
 	}
 }
 
+// stubWalkSettings stubs the shared walk settings store with a temporary
+// directory that contains the provided settings. It returns a function that
+// returns the settings that are currently saved.
+func stubWalkSettings(t *testing.T, ws *walkSettings) func() *walkSettings {
+	t.Helper()
+	c, err := cache.FromDir(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	commandtest.StubValue(t, &walkSettingsCache, func() (*cache.Cache, error) { return c, nil })
+	if err := ws.save(); err != nil {
+		t.Fatalf("failed to save walk settings: %v", err)
+	}
+	return func() *walkSettings {
+		got, err := loadWalkSettings()
+		if err != nil {
+			t.Fatalf("failed to load walk settings: %v", err)
+		}
+		return got
+	}
+}
+
 func TestAutocomplete(t *testing.T) {
 	for _, test := range []struct {
-		name string
-		r    *recursive
-		ctc  *commandtest.CompleteTestCase
+		name     string
+		settings *walkSettings
+		ctc      *commandtest.CompleteTestCase
 	}{
 		{
 			name: "delete completes ignore file patterns",
-			r: &recursive{
+			settings: &walkSettings{
 				IgnoreFilePatterns: map[string]bool{
 					"abc": true,
 					"def": true,
@@ -943,15 +1521,186 @@ func TestAutocomplete(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "delete completes directory aliases",
+			settings: &walkSettings{
+				DirectoryAliases: map[string]string{
+					"ooo": "testing/other",
+					"t":   "testing",
+				},
+			},
+			ctc: &commandtest.CompleteTestCase{
+				Args: "cmd da d ",
+				Want: &command.Autocompletion{
+					Suggestions: []string{"ooo", "t"},
+				},
+				WantData: &command.Data{
+					Values: map[string]interface{}{
+						aliasArg.Name(): "",
+					},
+				},
+			},
+		},
+		{
+			name: "directory flag completes directory aliases",
+			settings: &walkSettings{
+				DirectoryAliases: map[string]string{
+					"ooo": "testing/other",
+					"t":   "testing",
+				},
+			},
+			ctc: &commandtest.CompleteTestCase{
+				Args: "cmd -D ",
+				Want: &command.Autocompletion{
+					Suggestions: []string{"ooo", "t"},
+				},
+				WantData: &command.Data{
+					Values: map[string]interface{}{
+						dirFlag.Name(): "",
+					},
+				},
+			},
+		},
 	} {
 		t.Run(test.name, func(t *testing.T) {
-			g := &Grep{test.r}
+			stubWalkSettings(t, test.settings)
+			g := RecursiveCLI()
 			test.ctc.Node = g.Node()
 			commandertest.AutocompleteTest(t, test.ctc)
 		})
 	}
 }
 
+func TestSharedWalkSettings(t *testing.T) {
+	commandtest.StubValue(t, &defaultColorValue, false)
+	commandtest.StubValue(t, &startDir, "testing")
+	getSettings := stubWalkSettings(t, &walkSettings{})
+	absOther := commandtest.FilepathAbs(t, "testing", "other")
+
+	// Update the settings with rp.
+	rp := RecursiveCLI()
+	commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+		Node: rp.Node(),
+		Args: []string{"if", "a", `\.py$`},
+		WantData: &command.Data{Values: map[string]interface{}{
+			ignoreFilePattern.Name(): []string{`\.py$`},
+		}},
+	})
+	commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+		Node: rp.Node(),
+		Args: []string{"da", "a", "o", filepath.Join("testing", "other")},
+		WantData: &command.Data{Values: map[string]interface{}{
+			aliasArg.Name():    "o",
+			aliasDirArg.Name(): absOther,
+		}},
+	})
+	commandertest.ChangeTest(t, nil, rp)
+
+	// fp uses the updated settings.
+	fp := FilenameCLI()
+	commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+		Node: fp.Node(),
+		Args: []string{"-f"},
+		WantStdout: strings.Join([]string{
+			filepath.Join("testing", "lots.txt"),
+			filepath.Join("testing", "numbered.txt"),
+			filepath.Join("testing", "other", "other.txt"),
+			filepath.Join("testing", "this.txt"),
+			"",
+		}, "\n"),
+		WantData: &command.Data{Values: map[string]interface{}{
+			filesOnlyFlag.Name(): true,
+		}},
+	})
+	commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+		Node: fp.Node(),
+		Args: []string{"-D", "o"},
+		WantStdout: strings.Join([]string{
+			absOther,
+			filepath.Join(absOther, "other.txt"),
+			"",
+		}, "\n"),
+		WantData: &command.Data{Values: map[string]interface{}{
+			dirFlag.Name(): "o",
+		}},
+	})
+
+	// And changes made with fp apply to rp.
+	commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+		Node: fp.Node(),
+		Args: []string{"if", "d", `\.py$`},
+		WantData: &command.Data{Values: map[string]interface{}{
+			ignoreFilePattern.Name(): []string{`\.py$`},
+		}},
+	})
+	commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+		Node:       RecursiveCLI().Node(),
+		Args:       []string{"^alpha", "-l", "-f", `\.py$`},
+		WantStdout: filepath.Join("testing", "that.py") + "\n",
+		WantData: &command.Data{Values: map[string]interface{}{
+			patternArgName:      [][]string{{"^alpha"}},
+			fileOnlyFlag.Name(): true,
+			fileArg.Name():      `\.py$`,
+		}},
+	})
+
+	want := &walkSettings{
+		DirectoryAliases: map[string]string{
+			"o": absOther,
+		},
+	}
+	if diff := cmp.Diff(want, getSettings(), cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("fp and rp produced incorrect walk settings (-want, +got):\n%s", diff)
+	}
+}
+
+func TestWalkSettingsMigration(t *testing.T) {
+	getSettings := stubWalkSettings(t, &walkSettings{
+		DirectoryAliases: map[string]string{
+			"t": "testing",
+		},
+	})
+
+	// Settings that rp saved before they were shared are moved into the
+	// shared settings (without overriding them).
+	rp := &Grep{
+		InputSource: &recursive{
+			walkConfig: walkConfig{
+				DirectoryAliases: map[string]string{
+					"o": filepath.Join("testing", "other"),
+					"t": "old",
+				},
+				IgnoreFilePatterns: map[string]bool{
+					`\.py$`: true,
+				},
+			},
+		},
+	}
+	commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+		Node: rp.Node(),
+		Args: []string{"da", "l"},
+		WantStdout: strings.Join([]string{
+			fmt.Sprintf("o: %s", filepath.Join("testing", "other")),
+			"t: testing",
+			"",
+		}, "\n"),
+	})
+	commandertest.ChangeTest(t, &Grep{InputSource: &recursive{}}, rp, cmp.AllowUnexported(recursive{}), cmpopts.IgnoreUnexported(walkConfig{}, Grep{}), cmpopts.EquateEmpty())
+
+	want := &walkSettings{
+		DirectoryAliases: map[string]string{
+			"o": filepath.Join("testing", "other"),
+			"t": "testing",
+		},
+		IgnoreFilePatterns: map[string]bool{
+			`\.py$`: true,
+		},
+	}
+	if diff := cmp.Diff(want, getSettings(), cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("rp produced incorrect walk settings (-want, +got):\n%s", diff)
+	}
+}
+
 func TestRecusriveMetadata(t *testing.T) {
 	c := RecursiveCLI()
 
@@ -971,7 +1720,20 @@ func TestUsage(t *testing.T) {
 		Node: RecursiveCLI().Node(),
 		Args: []string{"--help"},
 		WantStdout: strings.Join([]string{
-			`┳ { [ PATTERN ... ] | } ... --file|-f FILE --invert-file|-F INVERT_FILE --hide-file|-h --file-only|-l --before|-b BEFORE --after|-a AFTER --depth|-d DEPTH --directory|-D DIRECTORY --hide-lines|-n --ignore-ignore-files|-x --case|-i --color|-C --invert|-v [ INVERT ... ] --match-only|-o --unique|-u --whole-word|-w`,
+			`┳ { [ PATTERN ... ] | } ... --file|-f FILE --invert-file|-F INVERT_FILE --hide-file|-h --file-only|-l --print0 --before|-b BEFORE --after|-a AFTER --passthru --gutter --depth|-d DEPTH --min-depth MIN_DEPTH --directory|-D DIRECTORY --hide-lines|-n --ignore-ignore-files|-x --strict --read-special --follow|-L --files-from FILES_FROM --since SINCE --until UNTIL --time-format TIME_FORMAT --sorted --record-start RECORD_START --paragraph --case|-i --color|-C --invert|-v [ INVERT ... ] --match-only|-o --quiet|-q --unique|-u --whole-word|-w`,
+			`┃`,
+			`┃   Commands around directory aliases`,
+			`┣━━ da ┓`,
+			`┃   ┏━━┛`,
+			`┃   ┃`,
+			`┃   ┃   Add a directory alias`,
+			`┃   ┣━━ a ALIAS DIRECTORY`,
+			`┃   ┃`,
+			`┃   ┃   Deletes a directory alias`,
+			`┃   ┣━━ d ALIAS`,
+			`┃   ┃`,
+			`┃   ┃   List directory aliases`,
+			`┃   ┗━━ l`,
 			`┃`,
 			`┃   Commands around global ignore file patterns`,
 			`┗━━ if ┓`,
@@ -987,7 +1749,11 @@ func TestUsage(t *testing.T) {
 			`    ┗━━ l`,
 			``,
 			`Arguments:`,
-			`  IGNORE_PATTERN: Files that match these will be ignored`,
+			`  ALIAS: The name of the directory alias`,
+			`  DIRECTORY: The directory that the alias refers to`,
+			`    FileExists()`,
+			`    IsDir()`,
+			`  IGNORE_PATTERN: Files (and directories) that match these will be ignored`,
 			`    IsRegex()`,
 			`  PATTERN: Pattern(s) required to be present in each line. The list breaker acts as an OR operator for groups of regexes`,
 			`    IsRegex()`,
@@ -999,9 +1765,12 @@ func TestUsage(t *testing.T) {
 			`  [C] color: Force (or unforce) the grep output to include color`,
 			`  [d] depth: The depth of files to search`,
 			`    NonNegative()`,
-			`  [D] directory: Search through the provided directory instead of pwd`,
+			`  [D] directory: Search through the provided directory alias instead of pwd`,
 			`  [f] file: Only select files that match this pattern`,
 			`  [l] file-only: Only show file names`,
+			"      files-from: Search the files (and directories) listed in this file (one per line) instead of the current directory. Use `-` to read the list from stdin (e.g. `git diff --name-only | rp PATTERN --files-from -`)",
+			`  [L] follow: Follow symlinks to directories`,
+			`      gutter: With --passthru, prefix matching lines with a marker`,
 			`  [h] hide-file: Don't show file names`,
 			`  [n] hide-lines: Don't include the line number in the output`,
 			`  [x] ignore-ignore-files: Ignore the provided IGNORE_PATTERNS`,
@@ -1009,7 +1778,23 @@ func TestUsage(t *testing.T) {
 			`    IsRegex()`,
 			`  [F] invert-file: Only select files that don't match this pattern`,
 			`  [o] match-only: Only show the matching segment`,
+			`      min-depth: The minimum depth of files to search`,
+			`    NonNegative()`,
+			`      paragraph: Group lines into records separated by blank lines. Each record is matched as a whole`,
+			`      passthru: Print every line (not just matching ones), highlighting the matches. The before and after flags are ignored`,
+			"      print0: Terminate each path with a NUL character instead of a newline (e.g. for `xargs -0`)",
+			`  [q] quiet: Don't print anything and stop at the first match`,
+			`      read-special: Read FIFOs, sockets, and device files instead of skipping them`,
+			`      record-start: Group lines into records that start with a line matching this regex (e.g. for stack traces or multi-line log entries). Each record is matched as a whole`,
+			`    IsRegex()`,
+			`      since: Only search lines with a timestamp at or after this time (e.g. 3d, 10:32, 2024-01-02 10:32, or RFC3339)`,
+			`    IsTime()`,
+			`      sorted: Stop reading once a timestamp after --until is found (assumes lines are sorted by time)`,
+			`      strict: Stop searching at the first file or directory that can't be read`,
+			`      time-format: The go time layout of the timestamp at the start of each line (by default, RFC3339, syslog, and epoch millisecond timestamps are detected)`,
 			`  [u] unique: Only display unique values (this only considers actual file lines, not file or line number decorations)`,
+			`      until: Only search lines with a timestamp at or before this time (e.g. 2h, 10:45, 2024-01-02 10:45, or RFC3339)`,
+			`    IsTime()`,
 			`  [w] whole-word: Whether or not to search for exact match`,
 			``,
 			`Symbols:`,
@@ -1023,20 +1808,42 @@ func TestUsage(t *testing.T) {
 		Node: HistoryCLI().Node(),
 		Args: []string{"--help"},
 		WantStdout: strings.Join([]string{
-			"{ [ PATTERN ... ] | } ... --case|-i --color|-C --invert|-v [ INVERT ... ] --match-only|-o --unique|-u --whole-word|-w",
+			"┳ { [ PATTERN ... ] | } ... --source|-s SOURCE [ SOURCE ... ] --since SINCE --until UNTIL --recent|-r --rank|-R --rank-by RANK_BY --before|-b BEFORE --after|-a AFTER --group-separator|-g --line-numbers|-N --case|-i --color|-C --invert|-v [ INVERT ... ] --match-only|-o --quiet|-q --unique|-u --whole-word|-w",
+			"┃",
+			"┃   Run (or print) the Nth result of the last search",
+			"┗━━ x N --print|-p --yes|-y",
 			"",
 			"Arguments:",
+			"  N: The number of the result (from the last search) to use",
+			"    Positive()",
 			"  PATTERN: Pattern(s) required to be present in each line. The list breaker acts as an OR operator for groups of regexes",
 			"    IsRegex()",
 			"",
 			"Flags:",
+			"  [a] after: Show the matched line and the n lines after it",
+			"  [b] before: Show the matched line and the n lines before it",
 			"  [i] case: Don't ignore character casing",
 			"  [C] color: Force (or unforce) the grep output to include color",
+			"  [g] group-separator: Print a separator (--) between non-contiguous groups of lines when using the before or after flags",
 			"  [v] invert: Pattern(s) required to be absent in each line",
 			"    IsRegex()",
+			"  [N] line-numbers: Include the line number in the output",
 			"  [o] match-only: Only show the matching segment",
+			"  [p] print: Print the command (e.g. for eval or copying) instead of running it",
+			"  [q] quiet: Don't print anything and stop at the first match",
+			"  [R] rank: Collapse identical commands into one result (with a count), ordered by the rank-by flag",
+			"      rank-by: How ranked commands are ordered: frequency (the default), recency, or frecency (frequency weighted by recency)",
+			"    InList([frequency recency frecency])",
+			"  [r] recent: List the newest matches first. If multiple sources are searched, then every entry must have a timestamp (so entries can be ordered across sources)",
+			"      since: Only search lines with a timestamp at or after this time (e.g. 3d, 10:32, 2024-01-02 10:32, or RFC3339)",
+			"    IsTime()",
+			"  [s] source: The history source(s) to search. `session` (the default) is the output of the `history` command. The others are read directly from the shell's history file. Shells usually don't export HISTFILE, so (unless it's exported) the bash history file is ~/.bash_history",
+			"    InList([session bash zsh fish pwsh])",
 			"  [u] unique: Only display unique values (this only considers actual file lines, not file or line number decorations)",
+			"      until: Only search lines with a timestamp at or before this time (e.g. 2h, 10:45, 2024-01-02 10:45, or RFC3339)",
+			"    IsTime()",
 			"  [w] whole-word: Whether or not to search for exact match",
+			"  [y] yes: Run destructive commands without asking for confirmation",
 			"",
 			"Symbols:",
 			"  |: List breaker",
@@ -1049,21 +1856,77 @@ func TestUsage(t *testing.T) {
 		Node: FilenameCLI().Node(),
 		Args: []string{"--help"},
 		WantStdout: strings.Join([]string{
-			"{ [ PATTERN ... ] | } ... --cat|-c --file-only|-f --dir-only|-d --case|-i --color|-C --invert|-v [ INVERT ... ] --match-only|-o --unique|-u --whole-word|-w",
+			"┳ { [ PATTERN ... ] | } ... --cat|-c --file-only|-f --dir-only|-d --depth DEPTH --min-depth MIN_DEPTH --directory|-D DIRECTORY --ignore-ignore-files|-x --follow|-L --print0 --full-path|-p --long|-l --human-readable|-h --sort|-s SORT --reverse|-r --exec|-e EXEC --parallel|-P PARALLEL --fail-fast --rename RENAME --apply --case|-i --color|-C --invert|-v [ INVERT ... ] --match-only|-o --quiet|-q --unique|-u --whole-word|-w",
+			"┃",
+			"┃   Commands around directory aliases",
+			"┣━━ da ┓",
+			"┃   ┏━━┛",
+			"┃   ┃",
+			"┃   ┃   Add a directory alias",
+			"┃   ┣━━ a ALIAS DIRECTORY",
+			"┃   ┃",
+			"┃   ┃   Deletes a directory alias",
+			"┃   ┣━━ d ALIAS",
+			"┃   ┃",
+			"┃   ┃   List directory aliases",
+			"┃   ┗━━ l",
+			"┃",
+			"┃   Commands around global ignore file patterns",
+			"┣━━ if ┓",
+			"┃   ┏━━┛",
+			"┃   ┃",
+			"┃   ┃   Add a global file ignore pattern",
+			"┃   ┣━━ a IGNORE_PATTERN [ IGNORE_PATTERN ... ]",
+			"┃   ┃",
+			"┃   ┃   Deletes a global file ignore pattern",
+			"┃   ┣━━ d IGNORE_PATTERN [ IGNORE_PATTERN ... ]",
+			"┃   ┃",
+			"┃   ┃   List global file ignore patterns",
+			"┃   ┗━━ l",
+			"┃",
+			"┃   Revert the renames from the last `fp --rename --apply`",
+			"┗━━ undo",
 			"",
 			"Arguments:",
+			"  ALIAS: The name of the directory alias",
+			"  DIRECTORY: The directory that the alias refers to",
+			"    FileExists()",
+			"    IsDir()",
+			"  IGNORE_PATTERN: Files (and directories) that match these will be ignored",
+			"    IsRegex()",
 			"  PATTERN: Pattern(s) required to be present in each line. The list breaker acts as an OR operator for groups of regexes",
 			"    IsRegex()",
 			"",
 			"Flags:",
+			"      apply: Perform the renames from --rename (which can be reverted with `fp undo`)",
 			"  [i] case: Don't ignore character casing",
 			"  [c] cat: Run cat command on all files that match",
 			"  [C] color: Force (or unforce) the grep output to include color",
+			"      depth: The depth of files to search",
+			"    NonNegative()",
 			"  [d] dir-only: Only check directory names",
+			"  [D] directory: Search through the provided directory alias instead of pwd",
+			"  [e] exec: Run this command for each result. `{}` is replaced with the path and `{N}` with the Nth capture group of the first pattern that matches. If the command ends with `{} +`, then it's run once with all of the paths instead",
+			"      fail-fast: Stop running --exec commands after the first one fails",
 			"  [f] file-only: Only check file names",
+			"  [L] follow: Follow symlinks to directories",
+			"  [p] full-path: Match against (and highlight matches in) the path of each file relative to the searched directory, rather than just its base name",
+			"  [h] human-readable: With --long, show sizes in human-readable units (e.g. 1.5K, 20M)",
+			"  [x] ignore-ignore-files: Ignore the provided IGNORE_PATTERNS",
 			"  [v] invert: Pattern(s) required to be absent in each line",
 			"    IsRegex()",
+			"  [l] long: Show the permissions, size, and modification time of each file, and a type marker after its path (like `ls -lF`)",
 			"  [o] match-only: Only show the matching segment",
+			"      min-depth: The minimum depth of files to search",
+			"    NonNegative()",
+			"  [P] parallel: The number of --exec commands to run at once",
+			"    Positive()",
+			"      print0: Terminate each path with a NUL character instead of a newline (e.g. for `xargs -0`)",
+			"  [q] quiet: Don't print anything and stop at the first match",
+			"      rename: Rename each result to this template. `{}` is replaced with the matched name and `{N}` with the Nth capture group of the first pattern that matches. The new name is relative to the result's directory (or, if --full-path is set, to the walked directory unless it's absolute). Renames are only shown unless --apply is provided",
+			"  [r] reverse: Reverse the order of the results",
+			"  [s] sort: Sort results by name (base name), size (largest first), or mtime (newest first) instead of walk order",
+			"    InList([name size mtime])",
 			"  [u] unique: Only display unique values (this only considers actual file lines, not file or line number decorations)",
 			"  [w] whole-word: Whether or not to search for exact match",
 			"",
@@ -1078,7 +1941,7 @@ func TestUsage(t *testing.T) {
 		Node: StdinCLI().Node(),
 		Args: []string{"--help"},
 		WantStdout: strings.Join([]string{
-			"{ [ PATTERN ... ] | } ... --before|-b BEFORE --after|-a AFTER --case|-i --color|-C --invert|-v [ INVERT ... ] --match-only|-o --unique|-u --whole-word|-w",
+			"{ [ PATTERN ... ] | } ... --before|-b BEFORE --after|-a AFTER --passthru --gutter --line-numbers|-N --count|-c --group-separator|-g --label|-l LABEL --line-buffered --null-data|-z --rest REST --json|-j --logfmt --fields|-k FIELDS [ FIELDS ... ] --since SINCE --until UNTIL --time-format TIME_FORMAT --sorted --record-start RECORD_START --paragraph --keep-colors --case|-i --color|-C --invert|-v [ INVERT ... ] --match-only|-o --quiet|-q --unique|-u --whole-word|-w",
 			"",
 			"Arguments:",
 			"  PATTERN: Pattern(s) required to be present in each line. The list breaker acts as an OR operator for groups of regexes",
@@ -1089,10 +1952,33 @@ func TestUsage(t *testing.T) {
 			"  [b] before: Show the matched line and the n lines before it",
 			"  [i] case: Don't ignore character casing",
 			"  [C] color: Force (or unforce) the grep output to include color",
+			"  [c] count: Only print the number of matching lines",
+			"  [k] fields: Only print these fields of structured (JSON or logfmt) lines",
+			"  [g] group-separator: Print a separator (--) between non-contiguous groups of lines when using the before or after flags",
+			"      gutter: With --passthru, prefix matching lines with a marker",
 			"  [v] invert: Pattern(s) required to be absent in each line",
 			"    IsRegex()",
+			"  [j] json: Parse each line as a JSON object. Patterns of the form FIELD=VALUE or FIELD~REGEX (e.g. .level=error or msg~timeout) are matched against fields instead of the whole line",
+			"      keep-colors: Keep the input's colors outside of matched segments. By default, ANSI escape codes are removed from the input before matching and printing",
+			"  [l] label: Prefix each line with the provided label (similar to the file name in rp)",
+			"      line-buffered: Write each line of output in a single write as soon as it's complete (useful when streaming input, e.g. from `tail -f`). If the downstream command exits (e.g. `| head`), then ip exits quietly at the next write",
+			"  [N] line-numbers: Include the line number in the output",
+			"      logfmt: Parse each line as logfmt (key=value pairs). Patterns of the form FIELD=VALUE or FIELD~REGEX are matched against fields instead of the whole line",
 			"  [o] match-only: Only show the matching segment",
+			"  [z] null-data: Treat input and output lines as terminated by NUL characters instead of newlines",
+			"      paragraph: Group lines into records separated by blank lines. Each record is matched as a whole",
+			"      passthru: Print every line (not just matching ones), highlighting the matches. The before and after flags are ignored",
+			"  [q] quiet: Don't print anything and stop at the first match",
+			"      record-start: Group lines into records that start with a line matching this regex (e.g. for stack traces or multi-line log entries). Each record is matched as a whole",
+			"    IsRegex()",
+			"      rest: Write the lines that don't match to this file (or to stderr if `-`)",
+			"      since: Only search lines with a timestamp at or after this time (e.g. 3d, 10:32, 2024-01-02 10:32, or RFC3339)",
+			"    IsTime()",
+			"      sorted: Stop reading once a timestamp after --until is found (assumes lines are sorted by time)",
+			"      time-format: The go time layout of the timestamp at the start of each line (by default, RFC3339, syslog, and epoch millisecond timestamps are detected)",
 			"  [u] unique: Only display unique values (this only considers actual file lines, not file or line number decorations)",
+			"      until: Only search lines with a timestamp at or before this time (e.g. 2h, 10:45, 2024-01-02 10:45, or RFC3339)",
+			"    IsTime()",
 			"  [w] whole-word: Whether or not to search for exact match",
 			"",
 			"Symbols:",
@@ -1101,3 +1987,94 @@ func TestUsage(t *testing.T) {
 		}, "\n"),
 	})
 }
+
+type fakeFileInfo struct {
+	name string
+	mode fs.FileMode
+}
+
+func (ffi *fakeFileInfo) Name() string       { return ffi.name }
+func (ffi *fakeFileInfo) Size() int64        { return 0 }
+func (ffi *fakeFileInfo) Mode() fs.FileMode  { return ffi.mode }
+func (ffi *fakeFileInfo) ModTime() time.Time { return time.Time{} }
+func (ffi *fakeFileInfo) IsDir() bool        { return ffi.mode.IsDir() }
+func (ffi *fakeFileInfo) Sys() any           { return nil }
+
+func TestShouldOpen(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		mode        fs.FileMode
+		targetMode  fs.FileMode
+		statErr     error
+		readSpecial bool
+		want        bool
+		wantErr     error
+	}{
+		{
+			name: "opens regular files",
+			want: true,
+		},
+		{
+			name: "skips FIFOs",
+			mode: fs.ModeNamedPipe,
+		},
+		{
+			name: "skips sockets",
+			mode: fs.ModeSocket,
+		},
+		{
+			name: "skips device files",
+			mode: fs.ModeDevice | fs.ModeCharDevice,
+		},
+		{
+			name:        "opens special files if readSpecial is set",
+			mode:        fs.ModeNamedPipe,
+			readSpecial: true,
+			want:        true,
+		},
+		{
+			name: "opens symlinks to regular files",
+			mode: fs.ModeSymlink,
+			want: true,
+		},
+		{
+			name:       "skips symlinks to directories",
+			mode:       fs.ModeSymlink,
+			targetMode: fs.ModeDir,
+		},
+		{
+			name:       "skips symlinks to special files",
+			mode:       fs.ModeSymlink,
+			targetMode: fs.ModeNamedPipe,
+		},
+		{
+			name:        "opens symlinks to special files if readSpecial is set",
+			mode:        fs.ModeSymlink,
+			targetMode:  fs.ModeNamedPipe,
+			readSpecial: true,
+			want:        true,
+		},
+		{
+			name:    "returns error for broken symlinks",
+			mode:    fs.ModeSymlink,
+			statErr: fmt.Errorf("broken"),
+			wantErr: fmt.Errorf("broken"),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			commandtest.StubValue(t, &osStat, func(string) (fs.FileInfo, error) {
+				if test.statErr != nil {
+					return nil, test.statErr
+				}
+				return &fakeFileInfo{"target", test.targetMode}, nil
+			})
+
+			de := fs.FileInfoToDirEntry(&fakeFileInfo{"entry", test.mode})
+			got, err := shouldOpen("entry", de, test.readSpecial)
+			commandtest.CmpError(t, "shouldOpen()", test.wantErr, err)
+			if got != test.want {
+				t.Errorf("shouldOpen() returned %v; want %v", got, test.want)
+			}
+		})
+	}
+}
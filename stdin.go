@@ -2,12 +2,31 @@ package grep
 
 import (
 	"bufio"
+	"bytes"
+	"fmt"
+	"io"
 	"os"
+	"strings"
 
+	"github.com/leep-frog/command/color"
 	"github.com/leep-frog/command/command"
 	"github.com/leep-frog/command/commander"
 )
 
+var (
+	lineNumbersFlag    = commander.BoolFlag("line-numbers", 'N', "Include the line number in the output")
+	countFlag          = commander.BoolFlag("count", 'c', "Only print the number of matching lines")
+	groupSeparatorFlag = commander.BoolFlag("group-separator", 'g', "Print a separator (--) between non-contiguous groups of lines when using the before or after flags")
+	labelFlag          = commander.Flag[string]("label", 'l', "Prefix each line with the provided label (similar to the file name in rp)")
+	lineBufferedFlag   = commander.BoolFlag("line-buffered", commander.FlagNoShortName, "Write each line of output in a single write as soon as it's complete (useful when streaming input, e.g. from `tail -f`). If the downstream command exits (e.g. `| head`), then ip exits quietly at the next write")
+	restFlag           = commander.Flag[string]("rest", commander.FlagNoShortName, "Write the lines that don't match to this file (or to stderr if `-`)", &commander.FileCompleter[string]{})
+	nullDataFlag       = commander.BoolFlag("null-data", 'z', "Treat input and output lines as terminated by NUL characters instead of newlines")
+)
+
+var (
+	osCreate = func(s string) (io.WriteCloser, error) { return os.Create(s) }
+)
+
 func StdinCLI() *Grep {
 	return &Grep{
 		InputSource: &stdin{
@@ -18,6 +37,8 @@ func StdinCLI() *Grep {
 
 type stdin struct {
 	scanner *bufio.Scanner
+	// parser is used to parse structured (JSON or logfmt) lines.
+	parser *structuredParser
 }
 
 func (*stdin) Name() string    { return "ip" }
@@ -27,17 +48,263 @@ func (*stdin) Flags() []commander.FlagInterface {
 	return []commander.FlagInterface{
 		beforeFlag,
 		afterFlag,
+		passthruFlag,
+		gutterFlag,
+		lineNumbersFlag,
+		countFlag,
+		groupSeparatorFlag,
+		labelFlag,
+		lineBufferedFlag,
+		nullDataFlag,
+		restFlag,
+		jsonFlag,
+		logfmtFlag,
+		fieldsFlag,
+		sinceFlag,
+		untilFlag,
+		timeFormatFlag,
+		sortedFlag,
+		recordStartFlag,
+		paragraphFlag,
+		keepColorsFlag,
 	}
 }
 
 func (*stdin) MakeNode(n command.Node) command.Node { return n }
 
-func (si *stdin) Process(output command.Output, data *command.Data, f filter, ss *sliceSet) error {
-	list := newLinkedList(f, data, si.scanner)
-	for formattedString, _, ok := list.getNext(ss); ok; formattedString, _, ok = list.getNext(ss) {
-		applyFormat(output, data, formattedString)
-		output.Stdoutln()
+func (si *stdin) patternFilter(pattern string, data *command.Data) (filter, error) {
+	if si.parser == nil {
+		si.parser = newStructuredParser(data)
+	}
+	if si.parser == nil {
+		return nil, nil
+	}
+	return newFieldFilter(si.parser, pattern, data)
+}
+
+func (si *stdin) Process(output command.Output, data *command.Data, f filter, ss *sliceSet, res *searchResult) (retErr error) {
+	if jsonFlag.Get(data) && logfmtFlag.Get(data) {
+		return output.Stderrln("only one of --json and --logfmt can be provided")
+	}
+	if si.parser == nil {
+		si.parser = newStructuredParser(data)
+	}
+	fields := fieldsFlag.Get(data)
+	if len(fields) > 0 && si.parser == nil {
+		return output.Stderrln("--fields requires either --json or --logfmt")
+	}
+
+	if err := checkRecordFlags(output, data); err != nil {
+		return err
+	}
+
+	// Lines are terminated by NUL characters (e.g. from `find -print0`).
+	eol := "\n"
+	if nullDataFlag.Get(data) {
+		si.scanner.Split(scanNull)
+		eol = "\x00"
 	}
 
+	reject, closeRest, err := rejectFunc(output, data, eol)
+	if err != nil {
+		return err
+	}
+	// Rejected lines are lost if the rest file can't be written, so this is
+	// an error even if the search succeeded.
+	defer func() {
+		if err := closeRest(); err != nil && retErr == nil {
+			retErr = output.Stderrf("failed to write rest file: %v\n", err)
+		}
+	}()
+
+	if countFlag.Get(data) {
+		res.matched = si.count(output, data, f, ss, reject) > 0
+		return si.err(output)
+	}
+
+	// Note: lines are only kept in memory for the before window, so memory
+	// usage is bounded no matter how long the stream is. If the downstream
+	// command closes the pipe (e.g. `ip ... | head`), then the next write
+	// results in a SIGPIPE, which (by default in go) exits the program
+	// without any output.
+	if lineBufferedFlag.Get(data) {
+		lbo := &lineBufferedOutput{Output: output}
+		defer lbo.flush()
+		output = lbo
+	}
+
+	groupSeparator := groupSeparatorFlag.Get(data) && (data.Int(beforeFlag.Name()) > 0 || data.Int(afterFlag.Name()) > 0)
+	var prevLine int
+	list := si.newLinkedList(f, data)
+	list.reject = reject
+	for formattedString, line, ok := list.getNext(ss); ok; formattedString, line, ok = list.getNext(ss) {
+		if groupSeparator && prevLine > 0 && line > prevLine+1 {
+			output.Stdoutln("--")
+		}
+		prevLine = line
+		if list.isMatch() {
+			res.matched = true
+		}
+
+		lineOutput := passthruOutput(output, data, list)
+		if data.Has(labelFlag.Name()) {
+			applyFormatWithColor(lineOutput, data, fileColor, []string{"", labelFlag.Get(data)})
+			lineOutput.Stdout(":")
+		}
+		if lineNumbersFlag.Get(data) {
+			applyFormatWithColor(lineOutput, data, lineColor, []string{"", fmt.Sprintf("%d", line)})
+			lineOutput.Stdout(":")
+		}
+		if len(fields) > 0 {
+			formattedString = selectFields(si.parser, formattedString, fields)
+		}
+		applyFormat(lineOutput, data, formattedString)
+		lineOutput.Stdout(eol)
+		if stopAfterMatch(data) {
+			break
+		}
+	}
+
+	return si.err(output)
+}
+
+// rejectFunc returns a function that writes rejected lines to the file
+// provided by the rest flag (or nil if the flag isn't set), and a function
+// that closes the file. Rejected lines include the same label and line number
+// prefixes as matching lines, but are never colored. Write errors are sticky
+// (subsequent lines aren't written), and are returned by the close function.
+func rejectFunc(output command.Output, data *command.Data, eol string) (func(string, int), func() error, error) {
+	if !data.Has(restFlag.Name()) {
+		return nil, func() error { return nil }, nil
+	}
+
+	write := func(s string) { output.Stderr(s) }
+	closeFn := func() error { return nil }
+	if rest := restFlag.Get(data); rest != "-" {
+		f, err := osCreate(rest)
+		if err != nil {
+			return nil, nil, output.Stderrf("failed to create rest file: %v\n", err)
+		}
+		// bufio.Writer keeps the first write error and returns it from Flush.
+		w := bufio.NewWriter(f)
+		write = func(s string) { w.WriteString(s) }
+		closeFn = func() error {
+			if err := w.Flush(); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		}
+	}
+
+	return func(s string, lineNumber int) {
+		var prefix string
+		if data.Has(labelFlag.Name()) {
+			prefix += labelFlag.Get(data) + ":"
+		}
+		if lineNumbersFlag.Get(data) {
+			prefix += fmt.Sprintf("%d:", lineNumber)
+		}
+		write(prefix + s + eol)
+	}, closeFn, nil
+}
+
+// scanNull is a split function for a bufio.Scanner that returns each
+// NUL-terminated line of text.
+func scanNull(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	// If we're at EOF, we have a final, non-terminated line.
+	if atEOF {
+		return len(data), data, nil
+	}
+	// Request more data.
+	return 0, nil, nil
+}
+
+// newLinkedList returns a linked list for stdin. Unlike files, stdin is often
+// the (colored) output of another command, so ANSI escape sequences are
+// removed before searching.
+func (si *stdin) newLinkedList(f filter, data *command.Data) *linkedList {
+	list := newLinkedList(f, data, si.scanner)
+	list.stripANSI = true
+	// The original colors can't be kept if only the matched segments are
+	// printed or if output isn't colored.
+	list.keepANSI = keepColorsFlag.Get(data) && shouldColor(data) && !matchOnlyFlag.Get(data)
+	return list
+}
+
+// err returns an error if stdin could not be read (e.g. if a line is too long).
+func (si *stdin) err(output command.Output) error {
+	if err := si.scanner.Err(); err != nil {
+		return output.Stderrf("failed to read stdin: %v\n", err)
+	}
 	return nil
 }
+
+// count prints (and returns) the number of matching lines (prefixed by the
+// label, if provided).
+func (si *stdin) count(output command.Output, data *command.Data, f filter, ss *sliceSet, reject func(string, int)) int {
+	// Context (and passthru) lines aren't relevant when only counting matches.
+	list := si.newLinkedList(f, data)
+	list.before, list.after, list.lastMatch = 0, 0, 0
+	list.passthru = false
+	list.reject = reject
+
+	var count int
+	for _, _, ok := list.getNext(ss); ok; _, _, ok = list.getNext(ss) {
+		count++
+		if stopAfterMatch(data) {
+			break
+		}
+	}
+
+	if data.Has(labelFlag.Name()) {
+		applyFormatWithColor(output, data, fileColor, []string{"", labelFlag.Get(data)})
+		output.Stdout(":")
+	}
+	output.Stdoutln(count)
+	return count
+}
+
+// lineBufferedOutput is an output that buffers stdout writes until a line
+// (terminated by a newline or NUL character) is complete, at which point the
+// whole line is written at once.
+type lineBufferedOutput struct {
+	command.Output
+	buf strings.Builder
+}
+
+func (lbo *lineBufferedOutput) Stdout(s string) {
+	lbo.buf.WriteString(s)
+	b := lbo.buf.String()
+	if i := strings.LastIndexAny(b, "\n\x00"); i >= 0 {
+		lbo.Output.Stdout(b[:i+1])
+		lbo.buf.Reset()
+		lbo.buf.WriteString(b[i+1:])
+	}
+}
+
+func (lbo *lineBufferedOutput) Stdoutf(s string, a ...interface{}) {
+	lbo.Stdout(fmt.Sprintf(s, a...))
+}
+
+func (lbo *lineBufferedOutput) Stdoutln(a ...interface{}) {
+	lbo.Stdout(fmt.Sprintln(a...))
+}
+
+func (lbo *lineBufferedOutput) Color(fs ...color.Format) {
+	lbo.Stdout(color.OutputCode(fs...))
+}
+
+// flush writes any remaining (incomplete) line.
+func (lbo *lineBufferedOutput) flush() {
+	if lbo.buf.Len() > 0 {
+		lbo.Output.Stdout(lbo.buf.String())
+		lbo.buf.Reset()
+	}
+}
@@ -2,11 +2,22 @@ package grep
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/leep-frog/command/color"
 	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
 	"github.com/leep-frog/command/commandertest"
 	"github.com/leep-frog/command/commandtest"
 )
@@ -167,6 +178,643 @@ func TestStdin(t *testing.T) {
 					},
 				},
 			},
+			{
+				name: "quiet flag prints nothing",
+				input: []string{
+					"alpha",
+					"bravo",
+					"delta",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"a$", "-q"},
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:   [][]string{{"a$"}},
+							quietFlag.Name(): true,
+						},
+					},
+				},
+			},
+			{
+				name: "works with line numbers flag",
+				input: []string{
+					"alpha",
+					"bravo",
+					"charlie",
+					"delta",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"a$", "-N"},
+					WantStdout: strings.Join([]string{
+						fmt.Sprintf("%s:alph%s", fakeColor(lineColor, "1"), fakeColor(matchColor, "a")),
+						fmt.Sprintf("%s:delt%s", fakeColor(lineColor, "4"), fakeColor(matchColor, "a")),
+						"",
+					}, "\n"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:         [][]string{{"a$"}},
+							lineNumbersFlag.Name(): true,
+						},
+					},
+				},
+			},
+			{
+				name: "works with label and line numbers flags",
+				input: []string{
+					"alpha",
+					"bravo",
+					"charlie",
+					"delta",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"a$", "-N", "-l", "app"},
+					WantStdout: strings.Join([]string{
+						fmt.Sprintf("%s:%s:alph%s", fakeColor(fileColor, "app"), fakeColor(lineColor, "1"), fakeColor(matchColor, "a")),
+						fmt.Sprintf("%s:%s:delt%s", fakeColor(fileColor, "app"), fakeColor(lineColor, "4"), fakeColor(matchColor, "a")),
+						"",
+					}, "\n"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:         [][]string{{"a$"}},
+							lineNumbersFlag.Name(): true,
+							labelFlag.Name():       "app",
+						},
+					},
+				},
+			},
+			{
+				name: "works with count flag",
+				input: []string{
+					"alpha",
+					"bravo",
+					"charlie",
+					"delta",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"a$", "-c", "-b", "1"},
+					WantStdout: "2\n",
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:    [][]string{{"a$"}},
+							countFlag.Name():  true,
+							beforeFlag.Name(): 1,
+						},
+					},
+				},
+			},
+			{
+				name: "works with count and label flags",
+				input: []string{
+					"alpha",
+					"bravo",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"z", "-c", "-l", "app"},
+					WantStdout: fmt.Sprintf("%s:0\n", fakeColor(fileColor, "app")),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:   [][]string{{"z"}},
+							countFlag.Name(): true,
+							labelFlag.Name(): "app",
+						},
+					},
+				},
+			},
+			{
+				name: "works with group separator flag",
+				input: []string{
+					"zero",
+					"one",
+					"two",
+					"three",
+					"four",
+					"five",
+					"six",
+					"seven",
+					"eight",
+					"nine",
+					"ten",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^t", "-a", "1", "-g", "-N"},
+					WantStdout: strings.Join([]string{
+						fmt.Sprintf("%s:%s", fakeColor(lineColor, "3"), fakeColor(matchColor, "t")+"wo"),
+						fmt.Sprintf("%s:%s", fakeColor(lineColor, "4"), fakeColor(matchColor, "t")+"hree"),
+						fmt.Sprintf("%s:%s", fakeColor(lineColor, "5"), "four"),
+						"--",
+						fmt.Sprintf("%s:%s", fakeColor(lineColor, "11"), fakeColor(matchColor, "t")+"en"),
+						"",
+					}, "\n"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:            [][]string{{"^t"}},
+							afterFlag.Name():          1,
+							groupSeparatorFlag.Name(): true,
+							lineNumbersFlag.Name():    true,
+						},
+					},
+				},
+			},
+			{
+				name: "works with line buffered flag",
+				input: []string{
+					"alpha",
+					"bravo",
+					"charlie",
+					"delta",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"a$", "-N", "--line-buffered"},
+					WantStdout: strings.Join([]string{
+						fmt.Sprintf("%s:alph%s", fakeColor(lineColor, "1"), fakeColor(matchColor, "a")),
+						fmt.Sprintf("%s:delt%s", fakeColor(lineColor, "4"), fakeColor(matchColor, "a")),
+						"",
+					}, "\n"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:          [][]string{{"a$"}},
+							lineNumbersFlag.Name():  true,
+							lineBufferedFlag.Name(): true,
+						},
+					},
+				},
+			},
+			{
+				name: "errors if line is too long",
+				input: []string{
+					"alpha",
+					strings.Repeat("b", bufio.MaxScanTokenSize+1),
+				},
+				etc: &commandtest.ExecuteTestCase{
+					WantStdout: "alpha\n",
+					WantStderr: "failed to read stdin: bufio.Scanner: token too long\n",
+					WantErr:    fmt.Errorf("failed to read stdin: bufio.Scanner: token too long"),
+				},
+			},
+			{
+				name: "filters JSON fields",
+				input: []string{
+					`{"level":"error","service":"auth-api","msg":"request timeout"}`,
+					`{"level":"info","service":"auth-api","msg":"ok"}`,
+					`{"level":"error","service":"billing","msg":"boom"}`,
+					`level=error service=auth`,
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{".level=error", "service~auth", "--json"},
+					WantStdout: strings.Join([]string{
+						fmt.Sprintf(`{"level":"%s","service":"%s-api","msg":"request timeout"}`, fakeColor(matchColor, "error"), fakeColor(matchColor, "auth")),
+						"",
+					}, "\n"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:  [][]string{{".level=error", "service~auth"}},
+							jsonFlag.Name(): true,
+						},
+					},
+				},
+			},
+			{
+				name: "prints selected JSON fields",
+				input: []string{
+					`{"level":"error","service":"auth-api","msg":"request timeout"}`,
+					`{"level":"info","service":"auth-api","msg":"ok"}`,
+					`{"level":"error","service":"billing"}`,
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"level~err", "--json", "-k", "msg", "level"},
+					WantStdout: strings.Join([]string{
+						fmt.Sprintf("msg=request timeout level=%sor", fakeColor(matchColor, "err")),
+						fmt.Sprintf("level=%sor", fakeColor(matchColor, "err")),
+						"",
+					}, "\n"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:    [][]string{{"level~err"}},
+							jsonFlag.Name():   true,
+							fieldsFlag.Name(): []string{"msg", "level"},
+						},
+					},
+				},
+			},
+			{
+				name: "filters logfmt fields",
+				input: []string{
+					`level=error service=auth msg="request timed out"`,
+					`level=error service=auth msg="boom"`,
+					`level=info msg="timed"`,
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"level=ERROR", "msg~timed", "--logfmt"},
+					WantStdout: strings.Join([]string{
+						fmt.Sprintf(`level=%s service=auth msg="request %s out"`, fakeColor(matchColor, "error"), fakeColor(matchColor, "timed")),
+						"",
+					}, "\n"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:    [][]string{{"level=ERROR", "msg~timed"}},
+							logfmtFlag.Name(): true,
+						},
+					},
+				},
+			},
+			{
+				name: "fails if json and logfmt flags",
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"--logfmt", "--json"},
+					WantStderr: "only one of --json and --logfmt can be provided\n",
+					WantErr:    fmt.Errorf("only one of --json and --logfmt can be provided"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							logfmtFlag.Name(): true,
+							jsonFlag.Name():   true,
+						},
+					},
+				},
+			},
+			{
+				name: "fails if fields flag without structured flag",
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"-k", "msg"},
+					WantStderr: "--fields requires either --json or --logfmt\n",
+					WantErr:    fmt.Errorf("--fields requires either --json or --logfmt"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							fieldsFlag.Name(): []string{"msg"},
+						},
+					},
+				},
+			},
+			{
+				name: "fails if invalid field regex",
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"msg~*", "--json"},
+					WantStderr: "invalid field pattern \"msg~*\": error parsing regexp: missing argument to repetition operator: `*`\n",
+					WantErr:    fmt.Errorf("invalid field pattern \"msg~*\": error parsing regexp: missing argument to repetition operator: `*`"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:  [][]string{{"msg~*"}},
+							jsonFlag.Name(): true,
+						},
+					},
+				},
+			},
+			{
+				name: "filters lines by time window",
+				input: []string{
+					"2024-01-02T10:30:00Z error zero",
+					"2024-01-02T10:32:00Z error one",
+					"  at stack",
+					"2024-01-02T10:40:00Z info",
+					"2024-01-02T10:46:00Z error two",
+					"  at stack",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"error|stack", "--since", "2024-01-02T10:32:00Z", "--until", "2024-01-02T10:45:00Z", "-N"},
+					WantStdout: strings.Join([]string{
+						fmt.Sprintf("%s:2024-01-02T10:32:00Z %s one", fakeColor(lineColor, "2"), fakeColor(matchColor, "error")),
+						fmt.Sprintf("%s:  at %s", fakeColor(lineColor, "3"), fakeColor(matchColor, "stack")),
+						"",
+					}, "\n"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:         [][]string{{"error|stack"}},
+							sinceFlag.Name():       "2024-01-02T10:32:00Z",
+							untilFlag.Name():       "2024-01-02T10:45:00Z",
+							lineNumbersFlag.Name(): true,
+						},
+					},
+				},
+			},
+			{
+				name: "ignores lines before the first timestamp",
+				input: []string{
+					"error before",
+					"2024-01-02T10:32:00Z error one",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"error", "--since", "2024-01-02T10:00:00Z"},
+					WantStdout: strings.Join([]string{
+						fmt.Sprintf("2024-01-02T10:32:00Z %s one", fakeColor(matchColor, "error")),
+						"",
+					}, "\n"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:   [][]string{{"error"}},
+							sinceFlag.Name(): "2024-01-02T10:00:00Z",
+						},
+					},
+				},
+			},
+			{
+				name: "counts lines in time window",
+				input: []string{
+					"2024-01-02T10:30:00Z error zero",
+					"2024-01-02T10:32:00Z error one",
+					"2024-01-02T10:46:00Z error two",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"error", "-c", "--until", "2024-01-02T10:45:00Z", "--sorted"},
+					WantStdout: "2\n",
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:    [][]string{{"error"}},
+							countFlag.Name():  true,
+							untilFlag.Name():  "2024-01-02T10:45:00Z",
+							sortedFlag.Name(): true,
+						},
+					},
+				},
+			},
+			{
+				name: "uses provided time format",
+				input: []string{
+					"02/01/2024 10:30:00 error zero",
+					"02/01/2024 10:32:00 error one",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"error", "--since", "2024-01-02 10:31", "--time-format", "02/01/2006 15:04:05"},
+					WantStdout: strings.Join([]string{
+						fmt.Sprintf("02/01/2024 10:32:00 %s one", fakeColor(matchColor, "error")),
+						"",
+					}, "\n"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:        [][]string{{"error"}},
+							sinceFlag.Name():      "2024-01-02 10:31",
+							timeFormatFlag.Name(): "02/01/2006 15:04:05",
+						},
+					},
+				},
+			},
+			{
+				name: "fails if invalid time bound",
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"--since", "yesterday"},
+					WantStderr: "validation for \"since\" failed: [IsTime] value \"yesterday\" isn't a supported time\n",
+					WantErr:    fmt.Errorf("validation for \"since\" failed: [IsTime] value \"yesterday\" isn't a supported time"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							sinceFlag.Name(): "yesterday",
+						},
+					},
+				},
+			},
+			{
+				name: "matches records that start with a pattern",
+				input: []string{
+					"2024-01-02 INFO starting",
+					"2024-01-02 ERROR request failed",
+					"java.lang.NullPointerException: oops",
+					"  at com.example.Main",
+					"2024-01-02 INFO done",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"NullPointer", "--record-start", `^\d{4}-`, "-N"},
+					WantStdout: strings.Join([]string{
+						fmt.Sprintf("%s:2024-01-02 ERROR request failed", fakeColor(lineColor, "2")),
+						fmt.Sprintf("java.lang.%sException: oops", fakeColor(matchColor, "NullPointer")),
+						"  at com.example.Main",
+						"",
+					}, "\n"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:         [][]string{{"NullPointer"}},
+							recordStartFlag.Name(): `^\d{4}-`,
+							lineNumbersFlag.Name(): true,
+						},
+					},
+				},
+			},
+			{
+				name: "matches paragraphs",
+				input: []string{
+					"first one",
+					"has alpha",
+					"",
+					"",
+					"second one",
+					"has bravo",
+					"and alpha",
+					"",
+					"third one",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"alpha", "bravo", "--paragraph", "-N"},
+					WantStdout: strings.Join([]string{
+						fmt.Sprintf("%s:second one", fakeColor(lineColor, "5")),
+						fmt.Sprintf("has %s", fakeColor(matchColor, "bravo")),
+						fmt.Sprintf("and %s", fakeColor(matchColor, "alpha")),
+						"",
+					}, "\n"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:         [][]string{{"alpha", "bravo"}},
+							paragraphFlag.Name():   true,
+							lineNumbersFlag.Name(): true,
+						},
+					},
+				},
+			},
+			{
+				name: "match only flag works with records",
+				input: []string{
+					"first one",
+					"has alpha",
+					"",
+					"second one",
+					"has bravo",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"has.*", "--paragraph", "-o"},
+					WantStdout: strings.Join([]string{
+						"has alpha",
+						"has bravo",
+						"",
+					}, "\n"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:       [][]string{{"has.*"}},
+							paragraphFlag.Name(): true,
+							matchOnlyFlag.Name(): true,
+						},
+					},
+				},
+			},
+			{
+				name: "counts records",
+				input: []string{
+					"first one",
+					"has alpha",
+					"",
+					"second one",
+					"has alpha",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"alpha", "--paragraph", "-c"},
+					WantStdout: "2\n",
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:       [][]string{{"alpha"}},
+							paragraphFlag.Name(): true,
+							countFlag.Name():     true,
+						},
+					},
+				},
+			},
+			{
+				name: "strips ANSI escape codes before matching",
+				input: []string{
+					"\x1b[31mred\x1b[0m alpha",
+					"\x1b[1;32mgreen\x1b[0m bravo",
+					"\x1b[34mblue\x1b[0m charlie",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^green bravo$", "-a", "1"},
+					WantStdout: strings.Join([]string{
+						fakeColor(matchColor, "green bravo"),
+						"blue charlie",
+						"",
+					}, "\n"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:   [][]string{{"^green bravo$"}},
+							afterFlag.Name(): 1,
+						},
+					},
+				},
+			},
+			{
+				name: "strips ANSI escape codes with match only flag",
+				input: []string{
+					"\x1b[31mred\x1b[0m alpha",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"d al", "-o", "--keep-colors"},
+					WantStdout: "d al\n",
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:        [][]string{{"d al"}},
+							matchOnlyFlag.Name():  true,
+							keepColorsFlag.Name(): true,
+						},
+					},
+				},
+			},
+			{
+				name: "reads and writes NUL-terminated lines",
+				input: []string{
+					"alpha\x00bravo one\nbravo two\x00charlie\x00",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^bravo", "-z"},
+					WantStdout: strings.Join([]string{
+						fmt.Sprintf("%s one\nbravo two", fakeColor(matchColor, "bravo")),
+						"",
+					}, "\x00"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:      [][]string{{"^bravo"}},
+							nullDataFlag.Name(): true,
+						},
+					},
+				},
+			},
+			{
+				name: "reads final NUL-terminated line without terminator",
+				input: []string{
+					"alpha\x00bravo",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"^bravo", "-z", "-c"},
+					WantStdout: "1\n",
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:      [][]string{{"^bravo"}},
+							nullDataFlag.Name(): true,
+							countFlag.Name():    true,
+						},
+					},
+				},
+			},
+			{
+				name: "passthru prints every line with gutter",
+				input: []string{
+					"alpha",
+					"bravo",
+					"charlie",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^b", "--passthru", "--gutter", "-N", "-b", "2"},
+					WantStdout: strings.Join([]string{
+						fmt.Sprintf("  %s:alpha", fakeColor(lineColor, "1")),
+						fmt.Sprintf("%s %s:%sravo", fakeColor(matchColor, ">"), fakeColor(lineColor, "2"), fakeColor(matchColor, "b")),
+						fmt.Sprintf("  %s:charlie", fakeColor(lineColor, "3")),
+						"",
+					}, "\n"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:         [][]string{{"^b"}},
+							passthruFlag.Name():    true,
+							gutterFlag.Name():      true,
+							lineNumbersFlag.Name(): true,
+							beforeFlag.Name():      2,
+						},
+					},
+				},
+			},
+			{
+				name: "writes rejected lines to stderr",
+				input: []string{
+					"alpha",
+					"bravo",
+					"alpha",
+					"charlie",
+					"alpine",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"^al", "-v", "ine", "-u", "-N", "--rest", "-"},
+					WantStdout: strings.Join([]string{
+						fmt.Sprintf("%s:%spha", fakeColor(lineColor, "1"), fakeColor(matchColor, "al")),
+						"",
+					}, "\n"),
+					WantStderr: strings.Join([]string{
+						"2:bravo",
+						"3:alpha",
+						"4:charlie",
+						"5:alpine",
+						"",
+					}, "\n"),
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:         [][]string{{"^al"}},
+							invertFlag.Name():      []string{"ine"},
+							uniqueFlag.Name():      true,
+							lineNumbersFlag.Name(): true,
+							restFlag.Name():        "-",
+						},
+					},
+				},
+			},
+			{
+				name: "writes rejected lines to stderr when counting",
+				input: []string{
+					"alpha",
+					"bravo",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"^al", "-c", "-l", "app", "--rest", "-"},
+					WantStdout: fmt.Sprintf("%s:1\n", fakeColor(fileColor, "app")),
+					WantStderr: "app:bravo\n",
+					WantData: &command.Data{
+						Values: map[string]interface{}{
+							patternArgName:   [][]string{{"^al"}},
+							countFlag.Name(): true,
+							labelFlag.Name(): "app",
+							restFlag.Name():  "-",
+						},
+					},
+				},
+			},
 		} {
 			t.Run(testName(sc, test.name), func(t *testing.T) {
 				si := &Grep{
@@ -181,3 +829,170 @@ func TestStdin(t *testing.T) {
 		}
 	}
 }
+
+func TestRestFile(t *testing.T) {
+	commandtest.StubValue(t, &defaultColorValue, false)
+	rest := filepath.Join(t.TempDir(), "rest.txt")
+	si := &Grep{
+		InputSource: &stdin{
+			scanner: bufio.NewScanner(strings.NewReader("alpha\nbravo\ncharlie")),
+		},
+	}
+	commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+		Node:          si.Node(),
+		Args:          []string{"^b", "--rest", rest},
+		WantStdout:    "bravo\n",
+		SkipDataCheck: true,
+	})
+
+	got, err := os.ReadFile(rest)
+	if err != nil {
+		t.Fatalf("failed to read rest file: %v", err)
+	}
+	if diff := cmp.Diff("alpha\ncharlie\n", string(got)); diff != "" {
+		t.Errorf("rest file has incorrect contents (-want, +got):\n%s", diff)
+	}
+}
+
+// failingWriter is a file that fails to write (e.g. because the disk is full)
+// or to close.
+type failingWriter struct {
+	writeErr error
+	closeErr error
+}
+
+func (fw *failingWriter) Write(b []byte) (int, error) {
+	if fw.writeErr != nil {
+		return 0, fw.writeErr
+	}
+	return len(b), nil
+}
+
+func (fw *failingWriter) Close() error {
+	return fw.closeErr
+}
+
+func TestRestFileErrors(t *testing.T) {
+	commandtest.StubValue(t, &defaultColorValue, false)
+	for _, test := range []struct {
+		name string
+		fw   *failingWriter
+		want string
+	}{
+		{
+			name: "errors on write error",
+			fw:   &failingWriter{writeErr: fmt.Errorf("no space left on device")},
+			want: "failed to write rest file: no space left on device",
+		},
+		{
+			name: "errors on close error",
+			fw:   &failingWriter{closeErr: fmt.Errorf("file already closed")},
+			want: "failed to write rest file: file already closed",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			commandtest.StubValue(t, &osCreate, func(string) (io.WriteCloser, error) { return test.fw, nil })
+			si := &Grep{
+				InputSource: &stdin{
+					scanner: bufio.NewScanner(strings.NewReader("alpha\nbravo\ncharlie")),
+				},
+			}
+			commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+				Node:          si.Node(),
+				Args:          []string{"^b", "--rest", "rest.txt"},
+				WantStdout:    "bravo\n",
+				WantStderr:    test.want + "\n",
+				WantErr:       fmt.Errorf(test.want),
+				SkipDataCheck: true,
+			})
+		})
+	}
+}
+
+func TestLineBufferedOutput(t *testing.T) {
+	o := commandtest.NewOutput()
+	lbo := &lineBufferedOutput{Output: o}
+	lbo.Stdout("one")
+	lbo.Stdoutf(" %s", "two")
+	lbo.Color(matchColor)
+	lbo.Stdoutln(" three")
+	lbo.Stdout("four\nfive")
+	lbo.flush()
+	o.Close()
+
+	want := []string{
+		fmt.Sprintf("one two%s three\n", color.OutputCode(matchColor)),
+		"four\n",
+		"five",
+	}
+	if diff := cmp.Diff(want, o.GetStdoutByCalls()); diff != "" {
+		t.Errorf("lineBufferedOutput produced incorrect stdout calls (-want, +got):\n%s", diff)
+	}
+}
+
+// TestLineBufferedBrokenPipe runs ip in a subprocess (this test binary) and
+// closes its stdout after the first line, like `ip ... | head -n 1` does.
+// ip should exit quietly (by SIGPIPE, like grep) instead of reporting an error
+// or blocking on its endless input.
+func TestLineBufferedBrokenPipe(t *testing.T) {
+	if os.Getenv("GREP_TEST_BROKEN_PIPE") == "1" {
+		o := command.NewOutput()
+		g := StdinCLI()
+		commander.Execute(g.Node(), command.ParseExecuteArgs([]string{"^alpha", "--line-buffered"}), o, nil)
+		o.Close()
+		os.Exit(0)
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGPIPE isn't sent on windows")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=^TestLineBufferedBrokenPipe$")
+	cmd.Env = append(os.Environ(), "GREP_TEST_BROKEN_PIPE=1", "LEEP_FROG_RP_NO_COLOR=1")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("failed to get stdin pipe: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("failed to get stdout pipe: %v", err)
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start ip: %v", err)
+	}
+
+	// Write input until ip exits.
+	go func() {
+		for {
+			if _, err := io.WriteString(stdin, "alpha\nbravo\n"); err != nil {
+				return
+			}
+		}
+	}()
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read from ip: %v", err)
+	}
+	if line != "alpha\n" {
+		t.Errorf("ip wrote %q; want %q", line, "alpha\n")
+	}
+	stdout.Close()
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		t.Fatalf("ip didn't exit after its stdout was closed")
+	}
+	if err != nil {
+		ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+		if !ok || !ws.Signaled() || ws.Signal() != syscall.SIGPIPE {
+			t.Errorf("ip exited with error %v; want exit by SIGPIPE", err)
+		}
+	}
+	if stderr.String() != "" {
+		t.Errorf("ip wrote to stderr: %q", stderr.String())
+	}
+}
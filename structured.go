@@ -0,0 +1,309 @@
+package grep
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+var (
+	jsonFlag   = commander.BoolFlag("json", 'j', "Parse each line as a JSON object. Patterns of the form FIELD=VALUE or FIELD~REGEX (e.g. .level=error or msg~timeout) are matched against fields instead of the whole line")
+	logfmtFlag = commander.BoolFlag("logfmt", commander.FlagNoShortName, "Parse each line as logfmt (key=value pairs). Patterns of the form FIELD=VALUE or FIELD~REGEX are matched against fields instead of the whole line")
+	fieldsFlag = commander.ListFlag[string]("fields", 'k', "Only print these fields of structured (JSON or logfmt) lines", 1, command.UnboundedList)
+
+	// fieldPredicateRegex matches patterns like `.level=error` and `msg~time.*out`.
+	// The leading period is optional.
+	fieldPredicateRegex = regexp.MustCompile(`^\.?([\w@.-]+)([=~])(.*)$`)
+)
+
+// field is a (possibly nested) value in a structured line.
+type field struct {
+	// value is the decoded value.
+	value string
+	// start and end are the indices of the value in the original line.
+	start int
+	end   int
+	// raw indicates whether or not the value is identical to the text in
+	// the original line (i.e. it contained no escaped characters).
+	raw bool
+}
+
+// structuredParser parses lines into fields. The most recently parsed line is
+// cached since multiple filters (and the output) check the same line.
+type structuredParser struct {
+	parseFunc func(string) (map[string]*field, bool)
+
+	line   string
+	fields map[string]*field
+	ok     bool
+	parsed bool
+}
+
+func (sp *structuredParser) parse(s string) (map[string]*field, bool) {
+	if !sp.parsed || s != sp.line {
+		sp.line = s
+		sp.fields, sp.ok = sp.parseFunc(s)
+		sp.parsed = true
+	}
+	return sp.fields, sp.ok
+}
+
+// fieldFilter is a filter that checks the value of a single field.
+type fieldFilter struct {
+	parser *structuredParser
+	name   string
+	// Exactly one of value and r is set.
+	value      string
+	ignoreCase bool
+	r          *regexp.Regexp
+}
+
+func (ff *fieldFilter) String() string {
+	if ff.r != nil {
+		return fmt.Sprintf("FIELD{%s~%s}", ff.name, ff.r.String())
+	}
+	return fmt.Sprintf("FIELD{%s=%s}", ff.name, ff.value)
+}
+
+func (ff *fieldFilter) filter(s string) ([]*match, bool) {
+	fields, ok := ff.parser.parse(s)
+	if !ok {
+		return nil, false
+	}
+	f, ok := fields[ff.name]
+	if !ok {
+		return nil, false
+	}
+
+	if ff.r == nil {
+		if f.value == ff.value || (ff.ignoreCase && strings.EqualFold(f.value, ff.value)) {
+			return []*match{{start: f.start, end: f.end}}, true
+		}
+		return nil, false
+	}
+
+	indices := ff.r.FindStringIndex(f.value)
+	if indices == nil {
+		return nil, false
+	}
+	// If the value contains escaped characters, then the indices don't
+	// line up with the original line, so just highlight the whole value.
+	if !f.raw {
+		return []*match{{start: f.start, end: f.end}}, true
+	}
+	return []*match{{start: f.start + indices[0], end: f.start + indices[1]}}, true
+}
+
+// newStructuredParser returns the parser for the structured format flag that
+// is set (or nil if none is set).
+func newStructuredParser(data *command.Data) *structuredParser {
+	switch {
+	case jsonFlag.Get(data):
+		return &structuredParser{parseFunc: parseJSON}
+	case logfmtFlag.Get(data):
+		return &structuredParser{parseFunc: parseLogfmt}
+	}
+	return nil
+}
+
+// newFieldFilter returns a field filter if the pattern is a field predicate,
+// otherwise it returns nil.
+func newFieldFilter(sp *structuredParser, pattern string, data *command.Data) (filter, error) {
+	m := fieldPredicateRegex.FindStringSubmatch(pattern)
+	if m == nil {
+		return nil, nil
+	}
+
+	ff := &fieldFilter{
+		parser:     sp,
+		name:       m[1],
+		ignoreCase: !caseFlag.Get(data),
+	}
+	if m[2] == "=" {
+		ff.value = m[3]
+		return ff, nil
+	}
+
+	r, err := regexp.Compile(patternRegex(m[3], data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid field pattern %q: %v", pattern, err)
+	}
+	ff.r = r
+	return ff, nil
+}
+
+// selectFields converts the formatted string of a structured line into one
+// that only contains the provided fields (as space-separated key=value
+// pairs). Highlighting of matched values is preserved.
+func selectFields(sp *structuredParser, formattedString []string, names []string) []string {
+	line := strings.Join(formattedString, "")
+	fields, ok := sp.parse(line)
+	if !ok {
+		return formattedString
+	}
+
+	// Determine which indices of the line are highlighted.
+	highlighted := make([]bool, len(line))
+	var idx int
+	for i, s := range formattedString {
+		if i%2 == 1 {
+			for j := idx; j < idx+len(s); j++ {
+				highlighted[j] = true
+			}
+		}
+		idx += len(s)
+	}
+
+	r := []string{""}
+	for _, name := range names {
+		f, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if len(r) > 1 || r[0] != "" {
+			r[len(r)-1] += " "
+		}
+		r[len(r)-1] += name + "="
+
+		for i := f.start; i < f.end; i++ {
+			// Start a new segment if the highlighting changes.
+			if highlighted[i] != (len(r)%2 == 0) {
+				r = append(r, "")
+			}
+			r[len(r)-1] += line[i : i+1]
+		}
+		if len(r)%2 == 0 {
+			r = append(r, "")
+		}
+	}
+	return r
+}
+
+// parseJSON parses a JSON object into its (flattened) fields. Nested fields
+// are joined with periods (e.g. `request.id` or `tags.0`).
+func parseJSON(s string) (map[string]*field, bool) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, false
+	}
+	fields := map[string]*field{}
+	if !parseJSONObject(dec, s, "", fields) {
+		return nil, false
+	}
+	return fields, true
+}
+
+func parseJSONObject(dec *json.Decoder, s, prefix string, fields map[string]*field) bool {
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		key, ok := t.(string)
+		if !ok {
+			return false
+		}
+		if !parseJSONValue(dec, s, prefix+key, fields) {
+			return false
+		}
+	}
+	// Closing brace
+	_, err := dec.Token()
+	return err == nil
+}
+
+func parseJSONValue(dec *json.Decoder, s, path string, fields map[string]*field) bool {
+	start := int(dec.InputOffset())
+	t, err := dec.Token()
+	if err != nil {
+		return false
+	}
+	end := int(dec.InputOffset())
+
+	// The text between the previous token and this one contains
+	// whitespace and separators (i.e. ':' and ',') that we need to skip.
+	start += strings.IndexFunc(s[start:end], func(r rune) bool {
+		return !unicode.IsSpace(r) && r != ':' && r != ','
+	})
+
+	switch v := t.(type) {
+	case json.Delim:
+		if v == '{' {
+			return parseJSONObject(dec, s, path+".", fields)
+		}
+		for i := 0; dec.More(); i++ {
+			if !parseJSONValue(dec, s, fmt.Sprintf("%s.%d", path, i), fields) {
+				return false
+			}
+		}
+		// Closing bracket
+		_, err := dec.Token()
+		return err == nil
+	case string:
+		// Don't include the quotes.
+		fields[path] = &field{v, start + 1, end - 1, s[start+1:end-1] == v}
+	default:
+		fields[path] = &field{s[start:end], start, end, true}
+	}
+	return true
+}
+
+// parseLogfmt parses a logfmt line (e.g. `level=info msg="hello there"`).
+func parseLogfmt(s string) (map[string]*field, bool) {
+	fields := map[string]*field{}
+	for i := 0; i < len(s); {
+		if s[i] == ' ' || s[i] == '\t' {
+			i++
+			continue
+		}
+
+		keyStart := i
+		for i < len(s) && s[i] != '=' && s[i] != ' ' && s[i] != '\t' {
+			i++
+		}
+		key := s[keyStart:i]
+		if i >= len(s) || s[i] != '=' {
+			// Key with no value.
+			fields[key] = &field{"", i, i, true}
+			continue
+		}
+		// Skip the '='
+		i++
+
+		if i < len(s) && s[i] == '"' {
+			valStart := i
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(s) {
+				return nil, false
+			}
+			i++
+			v, err := strconv.Unquote(s[valStart:i])
+			if err != nil {
+				return nil, false
+			}
+			fields[key] = &field{v, valStart + 1, i - 1, s[valStart+1:i-1] == v}
+			continue
+		}
+
+		valStart := i
+		for i < len(s) && s[i] != ' ' && s[i] != '\t' {
+			i++
+		}
+		fields[key] = &field{s[valStart:i], valStart, i, true}
+	}
+	if len(fields) == 0 {
+		return nil, false
+	}
+	return fields, true
+}
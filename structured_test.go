@@ -0,0 +1,106 @@
+package grep
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseStructured(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		parser func(string) (map[string]*field, bool)
+		line   string
+		want   map[string]*field
+		wantOK bool
+	}{
+		{
+			name:   "parses JSON object",
+			parser: parseJSON,
+			line:   `{"level": "info", "n": 12, "ok":true, "x":null}`,
+			want: map[string]*field{
+				"level": {"info", 11, 15, true},
+				"n":     {"12", 23, 25, true},
+				"ok":    {"true", 32, 36, true},
+				"x":     {"null", 42, 46, true},
+			},
+			wantOK: true,
+		},
+		{
+			name:   "parses nested JSON fields",
+			parser: parseJSON,
+			line:   `{"req":{"id":"a"},"tags":["b",3]}`,
+			want: map[string]*field{
+				"req.id": {"a", 14, 15, true},
+				"tags.0": {"b", 27, 28, true},
+				"tags.1": {"3", 30, 31, true},
+			},
+			wantOK: true,
+		},
+		{
+			name:   "parses JSON with escaped characters",
+			parser: parseJSON,
+			line:   `{"msg":"a\"b"}`,
+			want: map[string]*field{
+				"msg": {`a"b`, 8, 12, false},
+			},
+			wantOK: true,
+		},
+		{
+			name:   "fails for JSON arrays",
+			parser: parseJSON,
+			line:   `["a"]`,
+		},
+		{
+			name:   "fails for invalid JSON",
+			parser: parseJSON,
+			line:   `{"a":`,
+		},
+		{
+			name:   "fails for non-JSON",
+			parser: parseJSON,
+			line:   `hello there`,
+		},
+		{
+			name:   "parses logfmt",
+			parser: parseLogfmt,
+			line:   `level=info msg="hello there" flag n=`,
+			want: map[string]*field{
+				"level": {"info", 6, 10, true},
+				"msg":   {"hello there", 16, 27, true},
+				"flag":  {"", 33, 33, true},
+				"n":     {"", 36, 36, true},
+			},
+			wantOK: true,
+		},
+		{
+			name:   "parses logfmt with escaped characters",
+			parser: parseLogfmt,
+			line:   `msg="a\"b"`,
+			want: map[string]*field{
+				"msg": {`a"b`, 5, 9, false},
+			},
+			wantOK: true,
+		},
+		{
+			name:   "fails for unterminated logfmt quote",
+			parser: parseLogfmt,
+			line:   `msg="abc`,
+		},
+		{
+			name:   "fails for empty logfmt",
+			parser: parseLogfmt,
+			line:   `  `,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := test.parser(test.line)
+			if ok != test.wantOK {
+				t.Errorf("parse(%q) returned ok=%v; want %v", test.line, ok, test.wantOK)
+			}
+			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(field{})); diff != "" {
+				t.Errorf("parse(%q) returned diff (-want, +got):\n%s", test.line, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package grep
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+var (
+	timeNow = time.Now
+
+	isTime = &commander.ValidatorOption[string]{
+		Validate: func(s string, d *command.Data) error {
+			_, err := parseTimeBound(s)
+			return err
+		},
+		Usage: "IsTime()",
+	}
+
+	sinceFlag      = commander.Flag[string]("since", commander.FlagNoShortName, "Only search lines with a timestamp at or after this time (e.g. 3d, 10:32, 2024-01-02 10:32, or RFC3339)", isTime)
+	untilFlag      = commander.Flag[string]("until", commander.FlagNoShortName, "Only search lines with a timestamp at or before this time (e.g. 2h, 10:45, 2024-01-02 10:45, or RFC3339)", isTime)
+	timeFormatFlag = commander.Flag[string]("time-format", commander.FlagNoShortName, "The go time layout of the timestamp at the start of each line (by default, RFC3339, syslog, and epoch millisecond timestamps are detected)")
+	sortedFlag     = commander.BoolFlag("sorted", commander.FlagNoShortName, "Stop reading once a timestamp after --until is found (assumes lines are sorted by time)")
+
+	rfc3339Regex     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`)
+	syslogRegex      = regexp.MustCompile(`^[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}`)
+	epochMillisRegex = regexp.MustCompile(`^\d{13}\b`)
+	// relativeTimeRegex matches times relative to now (e.g. `3d` for three
+	// days ago).
+	relativeTimeRegex = regexp.MustCompile(`^(\d+)([smhdw])$`)
+	relativeTimeUnits = map[string]time.Duration{
+		"s": time.Second,
+		"m": time.Minute,
+		"h": time.Hour,
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+
+	// timeBoundLayouts are the layouts accepted by the since and until flags.
+	timeBoundLayouts = []string{
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
+		"2006-01-02",
+	}
+	// timeOfDayLayouts are the layouts for bounds that only contain a time
+	// (in which case, today's date is used).
+	timeOfDayLayouts = []string{
+		"15:04:05",
+		"15:04",
+	}
+)
+
+// parseTimeBound parses the value of the since or until flag.
+func parseTimeBound(s string) (time.Time, error) {
+	if m := relativeTimeRegex.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err == nil {
+			return timeNow().Add(-time.Duration(n) * relativeTimeUnits[m[2]]), nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range timeBoundLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range timeOfDayLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			now := timeNow()
+			return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("[IsTime] value %q isn't a supported time", s)
+}
+
+// lineTimestamp returns the timestamp at the start of the line (if any). If
+// layout is empty, then common timestamp formats are detected.
+func lineTimestamp(line, layout string) (time.Time, bool) {
+	if layout != "" {
+		// Use as many (space-separated) words as there are in the layout.
+		words := strings.Fields(line)
+		n := len(strings.Fields(layout))
+		if len(words) < n {
+			return time.Time{}, false
+		}
+		t, err := time.ParseInLocation(layout, strings.Join(words[:n], " "), time.Local)
+		return t, err == nil
+	}
+
+	if m := rfc3339Regex.FindStringSubmatch(line); m != nil {
+		s := m[0][:10] + "T" + m[0][11:]
+		if m[2] == "" {
+			t, err := time.ParseInLocation("2006-01-02T15:04:05", s, time.Local)
+			return t, err == nil
+		}
+		// Add the colon to zone offsets like +0100
+		if m[2] != "Z" && !strings.Contains(m[2], ":") {
+			s = s[:len(s)-2] + ":" + s[len(s)-2:]
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		return t, err == nil
+	}
+
+	if m := syslogRegex.FindString(line); m != "" {
+		t, err := time.ParseInLocation(time.Stamp, m, time.Local)
+		if err != nil {
+			return time.Time{}, false
+		}
+		// Syslog timestamps don't include the year.
+		return t.AddDate(timeNow().Year(), 0, 0), true
+	}
+
+	if m := epochMillisRegex.FindString(line); m != "" {
+		ms, err := strconv.ParseInt(m, 10, 64)
+		return time.UnixMilli(ms), err == nil
+	}
+	return time.Time{}, false
+}
+
+// timeWindow determines which lines are within the since and until times.
+type timeWindow struct {
+	since  time.Time
+	until  time.Time
+	layout string
+	sorted bool
+
+	// current is the timestamp of the most recent line that had one. Lines
+	// without a timestamp (e.g. stack traces) are considered part of the
+	// previous line with one.
+	current    time.Time
+	hasCurrent bool
+}
+
+// newTimeWindow returns a time window based on the provided flags (or nil if
+// no time window flags were provided).
+func newTimeWindow(data *command.Data) *timeWindow {
+	if !data.Has(sinceFlag.Name()) && !data.Has(untilFlag.Name()) {
+		return nil
+	}
+	tw := &timeWindow{
+		layout: timeFormatFlag.Get(data),
+		sorted: sortedFlag.Get(data),
+	}
+	// The isTime validator ensures these are valid.
+	if data.Has(sinceFlag.Name()) {
+		tw.since, _ = parseTimeBound(sinceFlag.Get(data))
+	}
+	if data.Has(untilFlag.Name()) {
+		tw.until, _ = parseTimeBound(untilFlag.Get(data))
+	}
+	return tw
+}
+
+// check returns whether or not the line is in the time window, and whether
+// or not no subsequent lines can be in the time window.
+func (tw *timeWindow) check(line string) (bool, bool) {
+	if t, ok := lineTimestamp(line, tw.layout); ok {
+		tw.current = t
+		tw.hasCurrent = true
+	}
+
+	if !tw.hasCurrent {
+		return false, false
+	}
+	if !tw.until.IsZero() && tw.current.After(tw.until) {
+		return false, tw.sorted
+	}
+	return tw.contains(tw.current), false
+}
+
+// contains returns whether or not the time is in the time window.
+func (tw *timeWindow) contains(t time.Time) bool {
+	return (tw.since.IsZero() || !t.Before(tw.since)) && (tw.until.IsZero() || !t.After(tw.until))
+}
@@ -0,0 +1,120 @@
+package grep
+
+import (
+	"testing"
+	"time"
+
+	"github.com/leep-frog/command/commandtest"
+)
+
+func TestLineTimestamp(t *testing.T) {
+	commandtest.StubValue(t, &timeNow, func() time.Time {
+		return time.Date(2024, 3, 4, 5, 6, 7, 0, time.Local)
+	})
+	for _, test := range []struct {
+		name   string
+		line   string
+		layout string
+		want   time.Time
+		wantOK bool
+	}{
+		{
+			name:   "parses RFC3339 timestamp",
+			line:   "2024-01-02T10:32:00Z some message",
+			want:   time.Date(2024, 1, 2, 10, 32, 0, 0, time.UTC),
+			wantOK: true,
+		},
+		{
+			name:   "parses timestamp with space and fractional seconds",
+			line:   "2024-01-02 10:32:00.123+0100 some message",
+			want:   time.Date(2024, 1, 2, 9, 32, 0, 123000000, time.UTC),
+			wantOK: true,
+		},
+		{
+			name:   "parses timestamp without zone",
+			line:   "2024-01-02 10:32:00 some message",
+			want:   time.Date(2024, 1, 2, 10, 32, 0, 0, time.Local),
+			wantOK: true,
+		},
+		{
+			name:   "parses syslog timestamp",
+			line:   "Jan  2 10:32:00 host sshd[12]: message",
+			want:   time.Date(2024, 1, 2, 10, 32, 0, 0, time.Local),
+			wantOK: true,
+		},
+		{
+			name:   "parses epoch millis",
+			line:   "1704191520000 message",
+			want:   time.UnixMilli(1704191520000),
+			wantOK: true,
+		},
+		{
+			name:   "parses custom layout",
+			line:   "[02/Jan/2024:10:32:00] message",
+			layout: "[02/Jan/2006:15:04:05]",
+			want:   time.Date(2024, 1, 2, 10, 32, 0, 0, time.Local),
+			wantOK: true,
+		},
+		{
+			name:   "custom layout with multiple words",
+			line:   "02/01/2024 10:32 message",
+			layout: "02/01/2006 15:04",
+			want:   time.Date(2024, 1, 2, 10, 32, 0, 0, time.Local),
+			wantOK: true,
+		},
+		{
+			name:   "custom layout doesn't match",
+			line:   "2024-01-02T10:32:00Z message",
+			layout: "02/01/2006 15:04",
+		},
+		{
+			name: "no timestamp",
+			line: "  at some.stack.trace()",
+		},
+		{
+			name: "timestamp not at start of line",
+			line: "message 2024-01-02T10:32:00Z",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := lineTimestamp(test.line, test.layout)
+			if ok != test.wantOK || !got.Equal(test.want) {
+				t.Errorf("lineTimestamp(%q, %q) returned (%v, %v); want (%v, %v)", test.line, test.layout, got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseTimeBound(t *testing.T) {
+	commandtest.StubValue(t, &timeNow, func() time.Time {
+		return time.Date(2024, 3, 4, 5, 6, 7, 0, time.Local)
+	})
+	for _, test := range []struct {
+		s       string
+		want    time.Time
+		wantErr bool
+	}{
+		{s: "2024-01-02T10:32:00+02:00", want: time.Date(2024, 1, 2, 8, 32, 0, 0, time.UTC)},
+		{s: "2024-01-02T10:32:00", want: time.Date(2024, 1, 2, 10, 32, 0, 0, time.Local)},
+		{s: "2024-01-02 10:32:05", want: time.Date(2024, 1, 2, 10, 32, 5, 0, time.Local)},
+		{s: "2024-01-02 10:32", want: time.Date(2024, 1, 2, 10, 32, 0, 0, time.Local)},
+		{s: "2024-01-02", want: time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)},
+		{s: "10:32:05", want: time.Date(2024, 3, 4, 10, 32, 5, 0, time.Local)},
+		{s: "10:32", want: time.Date(2024, 3, 4, 10, 32, 0, 0, time.Local)},
+		{s: "3d", want: time.Date(2024, 3, 1, 5, 6, 7, 0, time.Local)},
+		{s: "90m", want: time.Date(2024, 3, 4, 3, 36, 7, 0, time.Local)},
+		{s: "1w", want: time.Date(2024, 2, 26, 5, 6, 7, 0, time.Local)},
+		{s: "3y", wantErr: true},
+		{s: "yesterday", wantErr: true},
+	} {
+		t.Run(test.s, func(t *testing.T) {
+			got, err := parseTimeBound(test.s)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseTimeBound(%q) returned error %v; want error %v", test.s, err, test.wantErr)
+			}
+			if !got.Equal(test.want) {
+				t.Errorf("parseTimeBound(%q) returned %v; want %v", test.s, got, test.want)
+			}
+		})
+	}
+}
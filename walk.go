@@ -0,0 +1,150 @@
+package grep
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+var (
+	minDepthFlag = commander.Flag[int]("min-depth", commander.FlagNoShortName, "The minimum depth of files to search", commander.NonNegative[int]())
+)
+
+// walker walks a file tree in the same way as `filepath.WalkDir`, but can
+// optionally descend into symlinked directories.
+type walker struct {
+	// follow indicates whether or not symlinks to directories should be walked.
+	follow bool
+	output command.Output
+	fn     fs.WalkDirFunc
+
+	// minDepth and maxDepth limit the depth (relative to the root) of the
+	// entries passed to fn. The root has depth 0, its children have depth 1,
+	// and so on. A maxDepth of 0 indicates no limit.
+	minDepth int
+	maxDepth int
+
+	// ignore contains patterns for the names of entries that are skipped
+	// (along with their contents, for directories). The root is never
+	// skipped.
+	ignore []*regexp.Regexp
+
+	// ancestors contains the directories in the path currently being walked.
+	// It is used to detect symlink cycles.
+	ancestors []fs.FileInfo
+}
+
+// walk walks the file tree rooted at root, calling fn for each file or
+// directory in the tree (including root). Like `filepath.WalkDir`, entries
+// are walked in lexical order and fn may return `fs.SkipDir` or `fs.SkipAll`.
+//
+// Paths passed to fn are always relative to the symlink (not its target), so
+// symlinked directories look like regular directories to the caller (and
+// depth is counted the same way for both).
+func (w *walker) walk(root string) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		err = w.fn(root, nil, err)
+	} else if d := w.resolve(root, fs.FileInfoToDirEntry(info)); d != nil {
+		err = w.walkDir(root, d, 0)
+	}
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// resolve returns the entry that should be walked for the provided entry.
+// If symlinks are followed, then links to directories are resolved to the
+// target directory. A nil entry is returned if the entry should be ignored
+// (e.g. broken links or cycles).
+func (w *walker) resolve(path string, d fs.DirEntry) fs.DirEntry {
+	if !w.follow || d.Type()&fs.ModeSymlink == 0 {
+		return d
+	}
+
+	info, err := osStat(path)
+	if err != nil {
+		w.output.Stderrf("warning: broken symlink %q: %v\n", path, err)
+		return nil
+	}
+
+	if !info.IsDir() {
+		return d
+	}
+
+	for _, a := range w.ancestors {
+		if os.SameFile(a, info) {
+			w.output.Stderrf("warning: symlink cycle detected at %q\n", path)
+			return nil
+		}
+	}
+	return fs.FileInfoToDirEntry(info)
+}
+
+func (w *walker) walkDir(path string, d fs.DirEntry, depth int) error {
+	if depth >= w.minDepth {
+		if err := w.fn(path, d, nil); err != nil || !d.IsDir() {
+			if err == fs.SkipDir && d.IsDir() {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	if !d.IsDir() || (w.maxDepth > 0 && depth >= w.maxDepth) {
+		return nil
+	}
+
+	if w.follow {
+		info, err := osStat(path)
+		if err == nil {
+			w.ancestors = append(w.ancestors, info)
+			defer func() { w.ancestors = w.ancestors[:len(w.ancestors)-1] }()
+		}
+	}
+
+	dirs, err := os.ReadDir(path)
+	if err != nil {
+		// Second call, to report ReadDir error.
+		err = w.fn(path, d, err)
+		if err != nil {
+			if err == fs.SkipDir && d.IsDir() {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	for _, d1 := range dirs {
+		if w.ignored(d1.Name()) {
+			continue
+		}
+		path1 := filepath.Join(path, d1.Name())
+		if d1 = w.resolve(path1, d1); d1 == nil {
+			continue
+		}
+		if err := w.walkDir(path1, d1, depth+1); err != nil {
+			if err == fs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// ignored returns whether or not the entry with the provided name should be
+// skipped.
+func (w *walker) ignored(name string) bool {
+	for _, r := range w.ignore {
+		if r.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
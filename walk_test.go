@@ -0,0 +1,101 @@
+package grep
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/leep-frog/command/commandtest"
+)
+
+func TestWalker(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "a"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "b"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "a", "x.txt"), []byte("x"), 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	for link, target := range map[string]string{
+		filepath.Join(root, "b", "link"):   filepath.Join("..", "a"),
+		filepath.Join(root, "b", "loop"):   "..",
+		filepath.Join(root, "b", "broken"): "nowhere",
+	} {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("symlinks are not supported: %v", err)
+		}
+	}
+
+	brokenPath := filepath.Join(root, "b", "broken")
+	_, brokenErr := os.Stat(brokenPath)
+
+	for _, test := range []struct {
+		name       string
+		follow     bool
+		want       []string
+		wantStderr string
+	}{
+		{
+			name: "doesn't follow symlinks",
+			want: []string{
+				".",
+				"a",
+				filepath.Join("a", "x.txt"),
+				"b",
+				filepath.Join("b", "broken"),
+				filepath.Join("b", "link"),
+				filepath.Join("b", "loop"),
+			},
+		},
+		{
+			name:   "follows symlinks",
+			follow: true,
+			want: []string{
+				".",
+				"a",
+				filepath.Join("a", "x.txt"),
+				"b",
+				filepath.Join("b", "link"),
+				filepath.Join("b", "link", "x.txt"),
+			},
+			wantStderr: fmt.Sprintf("warning: broken symlink %q: %v\nwarning: symlink cycle detected at %q\n", brokenPath, brokenErr, filepath.Join(root, "b", "loop")),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			o := commandtest.NewOutput()
+			var got []string
+			w := &walker{
+				follow: test.follow,
+				output: o,
+				fn: func(path string, de fs.DirEntry, err error) error {
+					if err != nil {
+						return err
+					}
+					rel, err := filepath.Rel(root, path)
+					if err != nil {
+						return err
+					}
+					got = append(got, rel)
+					return nil
+				},
+			}
+			if err := w.walk(root); err != nil {
+				t.Fatalf("walk() returned error: %v", err)
+			}
+			o.Close()
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("walk() produced incorrect paths (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(test.wantStderr, o.GetStderr()); diff != "" {
+				t.Errorf("walk() produced incorrect stderr (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package grep
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+	"github.com/leep-frog/command/sourcerer"
+)
+
+const (
+	// walkSettingsKey is the cache key for the settings that are shared by fp
+	// and rp.
+	walkSettingsKey = "leep-frog-grep-walk-settings.json"
+)
+
+var (
+	ignoreFilePattern = commander.ListArg[string]("IGNORE_PATTERN", "Files (and directories) that match these will be ignored", 1, command.UnboundedList, commander.ListifyValidatorOption(commander.IsRegex()))
+	aliasArg          = commander.Arg[string]("ALIAS", "The name of the directory alias")
+	aliasDirArg       = commander.FileArgument("DIRECTORY", "The directory that the alias refers to", commander.IsDir(), &commander.FileCompleter[string]{IgnoreFiles: true})
+
+	ignoreIgnoreFiles = commander.BoolFlag("ignore-ignore-files", 'x', "Ignore the provided IGNORE_PATTERNS")
+	dirFlag           = commander.Flag[string]("directory", 'D', "Search through the provided directory alias instead of pwd", aliasCompleter)
+	followFlag        = commander.BoolFlag("follow", 'L', "Follow symlinks to directories")
+
+	aliasCompleter = commander.CompleterFromFunc(func(v string, d *command.Data) (*command.Completion, error) {
+		ws, err := loadWalkSettings()
+		if err != nil {
+			return nil, err
+		}
+		var s []string
+		for a := range ws.DirectoryAliases {
+			s = append(s, a)
+		}
+		return &command.Completion{
+			Suggestions: s,
+		}, nil
+	})
+	ignoreCompleter = commander.CompleterFromFunc(func(v []string, d *command.Data) (*command.Completion, error) {
+		ws, err := loadWalkSettings()
+		if err != nil {
+			return nil, err
+		}
+		var s []string
+		for p := range ws.IgnoreFilePatterns {
+			s = append(s, p)
+		}
+		return &command.Completion{
+			Suggestions: s,
+		}, nil
+	})
+
+	// walkSettingsCache returns the cache in which the shared settings are
+	// stored (which is the same directory that sourcerer uses for each CLI's
+	// data).
+	walkSettingsCache = func() (*cache.Cache, error) {
+		dir, ok := command.OSLookupEnv(sourcerer.RootDirectoryEnvVar)
+		if !ok || dir == "" {
+			return nil, fmt.Errorf("environment variable %q is not set", sourcerer.RootDirectoryEnvVar)
+		}
+		return cache.FromDir(filepath.Join(dir, "cache"))
+	}
+)
+
+// walkSettings is the walker configuration that is shared by fp and rp (so
+// changes made with one command apply to the other).
+type walkSettings struct {
+	// DirectoryAliases maps aliases (for the directory flag) to directories.
+	DirectoryAliases map[string]string
+	// IgnoreFilePatterns contains patterns for the names of files and
+	// directories that are never walked.
+	IgnoreFilePatterns map[string]bool
+}
+
+// loadWalkSettings returns the shared settings (which are empty if they've
+// never been saved).
+func loadWalkSettings() (*walkSettings, error) {
+	c, err := walkSettingsCache()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get walk settings cache: %v", err)
+	}
+	ws := &walkSettings{}
+	if _, err := c.GetStruct(walkSettingsKey, ws); err != nil {
+		return nil, fmt.Errorf("failed to load walk settings: %v", err)
+	}
+	return ws, nil
+}
+
+// save writes the shared settings.
+func (ws *walkSettings) save() error {
+	c, err := walkSettingsCache()
+	if err != nil {
+		return fmt.Errorf("failed to get walk settings cache: %v", err)
+	}
+	if err := c.PutStruct(walkSettingsKey, ws); err != nil {
+		return fmt.Errorf("failed to save walk settings: %v", err)
+	}
+	return nil
+}
+
+// walkConfig provides the shared walker settings to fp and rp. It is
+// embedded in each input source.
+type walkConfig struct {
+	// DirectoryAliases and IgnoreFilePatterns are only set in data that was
+	// saved (by rp) before the settings were shared. They're moved into the
+	// shared settings when those are loaded.
+	DirectoryAliases   map[string]string `json:",omitempty"`
+	IgnoreFilePatterns map[string]bool   `json:",omitempty"`
+	changed            bool
+
+	// ws contains the shared settings (once they're loaded).
+	ws *walkSettings
+}
+
+func (wc *walkConfig) Changed() bool {
+	return wc.changed
+}
+
+// settings returns the shared settings, loading them if they haven't been
+// loaded yet.
+func (wc *walkConfig) settings() (*walkSettings, error) {
+	if wc.ws != nil {
+		return wc.ws, nil
+	}
+	ws, err := loadWalkSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	// Move any settings from before they were shared (without overriding
+	// newer ones).
+	if len(wc.DirectoryAliases) > 0 || len(wc.IgnoreFilePatterns) > 0 {
+		for a, dir := range wc.DirectoryAliases {
+			if _, ok := ws.DirectoryAliases[a]; !ok {
+				if ws.DirectoryAliases == nil {
+					ws.DirectoryAliases = map[string]string{}
+				}
+				ws.DirectoryAliases[a] = dir
+			}
+		}
+		for p := range wc.IgnoreFilePatterns {
+			if ws.IgnoreFilePatterns == nil {
+				ws.IgnoreFilePatterns = map[string]bool{}
+			}
+			ws.IgnoreFilePatterns[p] = true
+		}
+		if err := ws.save(); err != nil {
+			return nil, err
+		}
+		wc.DirectoryAliases, wc.IgnoreFilePatterns = nil, nil
+		wc.changed = true
+	}
+	wc.ws = ws
+	return ws, nil
+}
+
+// update loads the shared settings, applies the function to them, and then
+// saves them.
+func (wc *walkConfig) update(output command.Output, f func(*walkSettings) error) error {
+	ws, err := wc.settings()
+	if err != nil {
+		return output.Err(err)
+	}
+	if err := f(ws); err != nil {
+		return err
+	}
+	return output.Err(ws.save())
+}
+
+// makeNode returns a node with branches for updating the configuration (and
+// any additional branches). The provided node is run if no branch is selected.
+func (wc *walkConfig) makeNode(n command.Node, branches map[string]command.Node) command.Node {
+	bn := &commander.BranchNode{
+		Branches: map[string]command.Node{
+			"if": commander.SerialNodes(
+				commander.Description("Commands around global ignore file patterns"),
+				&commander.BranchNode{
+					Branches: map[string]command.Node{
+						"a": commander.SerialNodes(
+							commander.Description("Add a global file ignore pattern"),
+							ignoreFilePattern,
+							&commander.ExecutorProcessor{F: wc.addIgnorePattern},
+						),
+						"d": commander.SerialNodes(
+							commander.Description("Deletes a global file ignore pattern"),
+							ignoreFilePattern.AddOptions(ignoreCompleter),
+							&commander.ExecutorProcessor{F: wc.deleteIgnorePattern},
+						),
+						"l": commander.SerialNodes(
+							commander.Description("List global file ignore patterns"),
+							&commander.ExecutorProcessor{F: wc.listIgnorePattern},
+						),
+					},
+				},
+			),
+			"da": commander.SerialNodes(
+				commander.Description("Commands around directory aliases"),
+				&commander.BranchNode{
+					Branches: map[string]command.Node{
+						"a": commander.SerialNodes(
+							commander.Description("Add a directory alias"),
+							aliasArg,
+							aliasDirArg,
+							&commander.ExecutorProcessor{F: wc.addAlias},
+						),
+						"d": commander.SerialNodes(
+							commander.Description("Deletes a directory alias"),
+							aliasArg.AddOptions(aliasCompleter),
+							&commander.ExecutorProcessor{F: wc.deleteAlias},
+						),
+						"l": commander.SerialNodes(
+							commander.Description("List directory aliases"),
+							&commander.ExecutorProcessor{F: wc.listAliases},
+						),
+					},
+				},
+			),
+		},
+		Default: n,
+	}
+	for name, branch := range branches {
+		bn.Branches[name] = branch
+	}
+	return bn
+}
+
+func (wc *walkConfig) addIgnorePattern(output command.Output, data *command.Data) error {
+	return wc.update(output, func(ws *walkSettings) error {
+		if ws.IgnoreFilePatterns == nil {
+			ws.IgnoreFilePatterns = map[string]bool{}
+		}
+		for _, pattern := range data.StringList(ignoreFilePattern.Name()) {
+			ws.IgnoreFilePatterns[pattern] = true
+		}
+		return nil
+	})
+}
+
+func (wc *walkConfig) deleteIgnorePattern(output command.Output, data *command.Data) error {
+	return wc.update(output, func(ws *walkSettings) error {
+		for _, pattern := range data.StringList(ignoreFilePattern.Name()) {
+			delete(ws.IgnoreFilePatterns, pattern)
+		}
+		return nil
+	})
+}
+
+func (wc *walkConfig) listIgnorePattern(output command.Output, data *command.Data) error {
+	ws, err := wc.settings()
+	if err != nil {
+		return output.Err(err)
+	}
+	var patterns []string
+	for p := range ws.IgnoreFilePatterns {
+		patterns = append(patterns, p)
+	}
+	sort.Strings(patterns)
+	for _, p := range patterns {
+		output.Stdoutln(p)
+	}
+	return nil
+}
+
+func (wc *walkConfig) addAlias(output command.Output, data *command.Data) error {
+	return wc.update(output, func(ws *walkSettings) error {
+		if ws.DirectoryAliases == nil {
+			ws.DirectoryAliases = map[string]string{}
+		}
+		ws.DirectoryAliases[aliasArg.Get(data)] = aliasDirArg.Get(data)
+		return nil
+	})
+}
+
+func (wc *walkConfig) deleteAlias(output command.Output, data *command.Data) error {
+	return wc.update(output, func(ws *walkSettings) error {
+		alias := aliasArg.Get(data)
+		if _, ok := ws.DirectoryAliases[alias]; !ok {
+			return output.Stderrf("unknown alias: %q\n", alias)
+		}
+		delete(ws.DirectoryAliases, alias)
+		return nil
+	})
+}
+
+func (wc *walkConfig) listAliases(output command.Output, data *command.Data) error {
+	ws, err := wc.settings()
+	if err != nil {
+		return output.Err(err)
+	}
+	var aliases []string
+	for a := range ws.DirectoryAliases {
+		aliases = append(aliases, a)
+	}
+	sort.Strings(aliases)
+	for _, a := range aliases {
+		output.Stdoutf("%s: %s\n", a, ws.DirectoryAliases[a])
+	}
+	return nil
+}
+
+// root returns the directory to walk, which is the directory that the
+// directory flag refers to (or startDir if the flag isn't provided).
+func (wc *walkConfig) root(output command.Output, data *command.Data) (string, error) {
+	if !data.Has(dirFlag.Name()) {
+		return startDir, nil
+	}
+	ws, err := wc.settings()
+	if err != nil {
+		return "", output.Err(err)
+	}
+	da := dirFlag.Get(data)
+	dir, ok := ws.DirectoryAliases[da]
+	if !ok {
+		return "", output.Stderrf("unknown alias: %q\n", da)
+	}
+	return dir, nil
+}
+
+// newWalker returns a walker that uses the depth, follow, and ignore settings.
+// The walker's fn must still be set.
+func (wc *walkConfig) newWalker(output command.Output, data *command.Data) (*walker, error) {
+	ws, err := wc.settings()
+	if err != nil {
+		return nil, output.Err(err)
+	}
+	w := &walker{
+		follow:   followFlag.Get(data),
+		output:   output,
+		minDepth: minDepthFlag.Get(data),
+		// fp and rp have different depth flags, but they have the same name.
+		maxDepth: data.Int(depthFlag.Name()),
+	}
+	if !ignoreIgnoreFiles.Get(data) {
+		for ifp := range ws.IgnoreFilePatterns {
+			// ListIsRegex ArgumentOption ensures that these regexes are valid, so it's okay to use MustCompile here.
+			w.ignore = append(w.ignore, regexp.MustCompile(ifp))
+		}
+	}
+	return w, nil
+}